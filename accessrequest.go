@@ -0,0 +1,299 @@
+package rbac
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AccessRequestState represents the state of an AccessRequest
+type AccessRequestState int
+
+const (
+	_ AccessRequestState = iota // Initial value is invalid to prevent using not initialized fields
+
+	// AccessPending represents a request that waits for a decision
+	AccessPending
+
+	// AccessApproved represents a request that was approved and bound
+	AccessApproved
+
+	// AccessDenied represents a request that was denied
+	AccessDenied
+
+	// AccessRevoked represents an approved request whose RoleBinding was removed
+	AccessRevoked
+)
+
+func (s AccessRequestState) String() string {
+	if s < AccessPending || s > AccessRevoked {
+		return ""
+	}
+
+	return []string{"Pending", "Approved", "Denied", "Revoked"}[s-1]
+}
+
+// ApproveVerb and AccessRequestResource define the permission an approver needs
+// in the requested namespace, with the requested role as resource name:
+//
+//	Verbs: ["approve"]
+//	Resources: ["accessrequests"]
+//	ResourceNames: ["node-admin"]
+const (
+	ApproveVerb           = "approve"
+	AccessRequestResource = "accessrequests"
+)
+
+var (
+	// ErrAccessRequestNotFound is returned for unknown AccessRequest IDs
+	ErrAccessRequestNotFound = errors.New("access request not found")
+
+	// ErrAccessRequestDecided is returned if an AccessRequest isn't in the expected state
+	ErrAccessRequestDecided = errors.New("access request was already decided")
+
+	// ErrSelfApproval is returned if the requester tries to decide its own AccessRequest
+	ErrSelfApproval = errors.New("access request can't be decided by its requester")
+
+	// ErrApprovalForbidden is returned if the approver lacks the approve permission
+	ErrApprovalForbidden = errors.New("approver isn't allowed to decide the access request")
+)
+
+// AccessRequest represents a request of a subject for a role in a namespace
+// for a limited duration. An empty namespace requests global access.
+type AccessRequest struct {
+	ID          string
+	Subject     Subject
+	Role        string
+	Namespace   string
+	Duration    time.Duration
+	Reason      string
+	State       AccessRequestState
+	Created     time.Time
+	Decision    *Approval
+	RoleBinding string
+}
+
+// Approval records the decision about an AccessRequest. Approved requests
+// result in a RoleBinding that carries the approval chain in its Approvals.
+// Approver is the subject of the approver that holds the approve permission.
+type Approval struct {
+	Request   string    `json:"request" yaml:"request"`
+	Requester Subject   `json:"requester" yaml:"requester"`
+	Approver  Subject   `json:"approver" yaml:"approver"`
+	Reason    string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Comment   string    `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Time      time.Time `json:"time" yaml:"time"`
+}
+
+// AccessManager implements a just-in-time access workflow on top of an
+// Authorizer. Subjects request a role, a second subject holding the approve
+// permission approves or denies it and approved requests result in a
+// RoleBinding that expires after the requested duration.
+type AccessManager struct {
+	sync.Mutex
+	authz    *Authorizer
+	requests map[string]AccessRequest
+}
+
+// NewAccessManager instantiates an AccessManager that creates RoleBindings in
+// the given Authorizer and uses it to check the rights of approvers
+func NewAccessManager(authz *Authorizer) *AccessManager {
+	return &AccessManager{
+		authz:    authz,
+		requests: map[string]AccessRequest{},
+	}
+}
+
+// Request validates and registers a pending AccessRequest and returns it with
+// its ID.
+func (m *AccessManager) Request(r AccessRequest) (AccessRequest, error) {
+	if r.Subject.Name == "" || !r.Subject.Kind.valid() {
+		return AccessRequest{}, errors.New("AccessRequest needs to have a valid Subject")
+	}
+
+	if r.Role == "" {
+		return AccessRequest{}, errors.New("AccessRequest needs to have a Role")
+	}
+
+	if m.authz.GetRole(r.Role).Name == "" {
+		return AccessRequest{}, fmt.Errorf("AccessRequest for unknown Role %q", r.Role)
+	}
+
+	if r.Duration <= 0 {
+		return AccessRequest{}, errors.New("AccessRequest needs to have a positive Duration")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return AccessRequest{}, err
+	}
+
+	r.ID = hex.EncodeToString(id)
+	r.State = AccessPending
+	r.Created = m.authz.now()
+	r.Decision = nil
+	r.RoleBinding = ""
+
+	m.Lock()
+	m.requests[r.ID] = r
+	m.Unlock()
+	return r, nil
+}
+
+// Approve approves a pending AccessRequest and creates a RoleBinding that is
+// valid for the requested duration. The approver must not be the requester and
+// needs the ApproveVerb permission on AccessRequestResource.
+func (m *AccessManager) Approve(id string, approver []Subject, comment string) (RoleBinding, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	r, approval, err := m.decide(id, approver, comment)
+	if err != nil {
+		return RoleBinding{}, err
+	}
+
+	rb := RoleBinding{
+		Name:      "access-request-" + r.ID,
+		Role:      r.Role,
+		Namespace: r.Namespace,
+		Subjects:  []Subject{r.Subject},
+		NotBefore: approval.Time,
+		NotAfter:  approval.Time.Add(r.Duration),
+		Approvals: []Approval{approval},
+	}
+	if err := m.authz.SetRoleBinding(rb); err != nil {
+		return RoleBinding{}, err
+	}
+
+	r.State = AccessApproved
+	r.Decision = &approval
+	r.RoleBinding = rb.Name
+	m.requests[id] = r
+	return rb, nil
+}
+
+// Deny denies a pending AccessRequest. The same rules as for Approve apply to
+// the approver.
+func (m *AccessManager) Deny(id string, approver []Subject, comment string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	r, approval, err := m.decide(id, approver, comment)
+	if err != nil {
+		return err
+	}
+
+	r.State = AccessDenied
+	r.Decision = &approval
+	m.requests[id] = r
+	return nil
+}
+
+// Revoke removes the RoleBinding of an approved AccessRequest before it
+// expires. It can be revoked by the requester or by an approver.
+func (m *AccessManager) Revoke(id string, revoker []Subject) error {
+	m.Lock()
+	defer m.Unlock()
+
+	r, ok := m.requests[id]
+	if !ok {
+		return ErrAccessRequestNotFound
+	}
+
+	if r.State != AccessApproved {
+		return ErrAccessRequestDecided
+	}
+
+	if _, isRequester := matchSubjects([]Subject{r.Subject}, revoker); !isRequester && !m.canApprove(r, revoker).Success {
+		return ErrApprovalForbidden
+	}
+
+	m.authz.DeleteRoleBinding(r.RoleBinding)
+	r.State = AccessRevoked
+	m.requests[id] = r
+	return nil
+}
+
+// Get returns the AccessRequest with the given ID
+func (m *AccessManager) Get(id string) (AccessRequest, bool) {
+	m.Lock()
+	r, ok := m.requests[id]
+	m.Unlock()
+	return r, ok
+}
+
+// List returns all AccessRequests ordered by their creation time
+func (m *AccessManager) List() []AccessRequest {
+	return m.list(0)
+}
+
+// Pending returns all pending AccessRequests ordered by their creation time
+func (m *AccessManager) Pending() []AccessRequest {
+	return m.list(AccessPending)
+}
+
+// list returns the AccessRequests in the given state or all if `state` is zero
+func (m *AccessManager) list(state AccessRequestState) []AccessRequest {
+	m.Lock()
+	ret := []AccessRequest{}
+	for _, r := range m.requests {
+		if state == 0 || r.State == state {
+			ret = append(ret, r)
+		}
+	}
+	m.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Created.Equal(ret[j].Created) {
+			return ret[i].ID < ret[j].ID
+		}
+		return ret[i].Created.Before(ret[j].Created)
+	})
+	return ret
+}
+
+// decide checks if the approver may decide a pending AccessRequest and returns
+// the request and the approval record. The caller must hold the lock.
+func (m *AccessManager) decide(id string, approver []Subject, comment string) (AccessRequest, Approval, error) {
+	r, ok := m.requests[id]
+	if !ok {
+		return r, Approval{}, ErrAccessRequestNotFound
+	}
+
+	if r.State != AccessPending {
+		return r, Approval{}, ErrAccessRequestDecided
+	}
+
+	if _, isRequester := matchSubjects([]Subject{r.Subject}, approver); isRequester {
+		return r, Approval{}, ErrSelfApproval
+	}
+
+	res := m.canApprove(r, approver)
+	if !res.Success {
+		return r, Approval{}, ErrApprovalForbidden
+	}
+
+	// Record the subject that holds the approve permission
+	return r, Approval{
+		Request:   r.ID,
+		Requester: r.Subject,
+		Approver:  Subject{Name: res.Subject, Kind: res.SubjectType},
+		Reason:    r.Reason,
+		Comment:   comment,
+		Time:      m.authz.now(),
+	}, nil
+}
+
+// canApprove uses the Authorizer to check if `approver` may decide `r`. The
+// result names the subject that holds the approve permission.
+func (m *AccessManager) canApprove(r AccessRequest, approver []Subject) Result {
+	return m.authz.Eval(ApproveVerb, approver, Resource{
+		Namespace:    r.Namespace,
+		Resource:     AccessRequestResource,
+		ResourceName: r.Role,
+	})
+}
@@ -0,0 +1,127 @@
+package rbac
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAccessManager tests the workflow of requesting, approving, denying and revoking access
+func TestAccessManager(t *testing.T) {
+	now := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	a := New()
+	a.SetClock(func() time.Time { return now })
+
+	for _, role := range []Role{
+		{Name: "node-admin", Rules: []Rule{{Verbs: []string{"delete"}, Resources: []string{"nodes"}}}},
+		{Name: "approver", Rules: []Rule{{Verbs: []string{ApproveVerb}, Resources: []string{AccessRequestResource}, ResourceNames: []string{"node-admin"}}}},
+	} {
+		if err := a.SetRole(role); err != nil {
+			t.Fatalf("SetRole failed with %q", err)
+		}
+	}
+
+	err := a.SetRoleBinding(RoleBinding{Name: "approvers", Role: "approver", Namespace: "prod", Subjects: []Subject{
+		{Name: "admins", Kind: Group},
+	}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "leads", Role: "approver", Namespace: "prod", Subjects: []Subject{
+		{Name: "lead", Kind: User},
+	}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	m := NewAccessManager(a)
+	bofh := Subject{Name: "bofh", Kind: User}
+	boss := []Subject{{Name: "boss", Kind: User}, {Name: "admins", Kind: Group}}
+	nobody := []Subject{{Name: "nobody", Kind: User}}
+
+	if _, err := m.Request(AccessRequest{Subject: bofh, Role: "unknown", Duration: time.Hour}); err == nil {
+		t.Fatal("Request should fail for an unknown role")
+	}
+	if _, err := m.Request(AccessRequest{Subject: bofh, Role: "node-admin"}); err == nil {
+		t.Fatal("Request should fail without a duration")
+	}
+
+	r, err := m.Request(AccessRequest{Subject: bofh, Role: "node-admin", Namespace: "prod", Duration: time.Hour, Reason: "incident 42"})
+	if err != nil {
+		t.Fatalf("Request failed with %q", err)
+	}
+	if r.ID == "" || r.State != AccessPending {
+		t.Fatalf("Request should be pending with an ID: %+v", r)
+	}
+	if pending := m.Pending(); len(pending) != 1 || pending[0].ID != r.ID {
+		t.Fatalf("Expected request to be pending, got %+v", pending)
+	}
+
+	resource := Resource{Namespace: "prod", Resource: "nodes"}
+	if res := a.Eval("delete", []Subject{bofh}, resource); res.Success {
+		t.Fatalf("Should not validate before the approval, but did: %s", res)
+	}
+
+	if _, err := m.Approve("unknown", boss, ""); err != ErrAccessRequestNotFound {
+		t.Errorf("Expected ErrAccessRequestNotFound, got %v", err)
+	}
+	if _, err := m.Approve(r.ID, []Subject{bofh, {Name: "admins", Kind: Group}}, ""); err != ErrSelfApproval {
+		t.Errorf("Expected ErrSelfApproval, got %v", err)
+	}
+	if _, err := m.Approve(r.ID, nobody, ""); err != ErrApprovalForbidden {
+		t.Errorf("Expected ErrApprovalForbidden, got %v", err)
+	}
+
+	rb, err := m.Approve(r.ID, boss, "go ahead")
+	if err != nil {
+		t.Fatalf("Approve failed with %q", err)
+	}
+	if !rb.NotAfter.Equal(now.Add(time.Hour)) || len(rb.Approvals) != 1 || rb.Approvals[0].Approver != boss[1] ||
+		rb.Approvals[0].Requester != bofh || rb.Approvals[0].Reason != "incident 42" {
+		t.Fatalf("Unexpected RoleBinding %+v", rb)
+	}
+	if _, err := m.Approve(r.ID, boss, ""); err != ErrAccessRequestDecided {
+		t.Errorf("Expected ErrAccessRequestDecided, got %v", err)
+	}
+
+	if res := a.Eval("delete", []Subject{bofh}, resource); !res.Success || res.RoleBinding != rb.Name {
+		t.Fatalf("Should validate after the approval, but didn't: %s", res)
+	}
+
+	now = now.Add(time.Hour)
+	if res := a.Eval("delete", []Subject{bofh}, resource); res.Success {
+		t.Fatalf("Should not validate after the approved window, but did: %s", res)
+	}
+
+	// Revoke
+	now = now.Add(-30 * time.Minute)
+	if err := m.Revoke(r.ID, nobody); err != ErrApprovalForbidden {
+		t.Errorf("Expected ErrApprovalForbidden, got %v", err)
+	}
+	if err := m.Revoke(r.ID, []Subject{bofh}); err != nil {
+		t.Fatalf("Revoke failed with %q", err)
+	}
+	if res := a.Eval("delete", []Subject{bofh}, resource); res.Success {
+		t.Fatalf("Should not validate after revoking, but did: %s", res)
+	}
+	if got, _ := m.Get(r.ID); got.State != AccessRevoked {
+		t.Errorf("Expected request to be revoked, got %s", got.State)
+	}
+
+	// Deny
+	r2, err := m.Request(AccessRequest{Subject: bofh, Role: "node-admin", Namespace: "prod", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("Request failed with %q", err)
+	}
+	lead := []Subject{{Name: "oncall", Kind: Group}, {Name: "lead", Kind: User}}
+	if err := m.Deny(r2.ID, lead, "not now"); err != nil {
+		t.Fatalf("Deny failed with %q", err)
+	}
+	if got, _ := m.Get(r2.ID); got.State != AccessDenied || got.Decision.Comment != "not now" {
+		t.Errorf("Expected request to be denied, got %+v", got)
+	} else if got.Decision.Approver != lead[1] {
+		t.Errorf("The granting subject should be recorded as approver, got %s", got.Decision.Approver)
+	}
+	if len(m.Pending()) != 0 || len(m.List()) != 2 {
+		t.Errorf("Expected no pending and two requests in total")
+	}
+}
@@ -0,0 +1,120 @@
+package rbac
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord represents an authorization decision as recorded by AuditLog.
+// Allowed decisions are attributed to the RoleBinding, the rule of its Role and
+// the subject of the RoleBinding that granted the request.
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	Request     Request   `json:"request"`
+	Allowed     bool      `json:"allowed"`
+	RoleBinding string    `json:"roleBinding,omitempty"`
+	Role        string    `json:"role,omitempty"`
+	Rule        int       `json:"rule,omitempty"`
+	Subject     *Subject  `json:"subject,omitempty"`
+}
+
+// AuditLog is an AuditSink that writes every decision as a line of JSON. The
+// records are timestamped with the time of the decision, see SetClock.
+type AuditLog struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewAuditLog instantiates an AuditLog writing to `w`
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// Audit writes the decision about a request as AuditRecord
+func (l *AuditLog) Audit(ctx context.Context, req Request, res Result, at time.Time) error {
+	rec := AuditRecord{
+		Time:        at,
+		Request:     req,
+		Allowed:     res.Success,
+		RoleBinding: res.RoleBinding,
+		Role:        res.Role,
+		Rule:        res.Rule,
+	}
+	if res.Success {
+		rec.Subject = &Subject{Name: res.Subject, Kind: res.SubjectType}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	_, err = l.w.Write(append(b, '\n'))
+	return err
+}
+
+// ReadAuditLog reads the records written by an AuditLog. Lines that can't be
+// decoded are skipped and reported by an *AuditLogError, the records of the
+// other lines are returned nevertheless.
+func ReadAuditLog(r io.Reader) ([]AuditRecord, error) {
+	var records []AuditRecord
+	var invalid AuditLogError
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		b, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(b)) > 0 {
+			var rec AuditRecord
+			if err := json.Unmarshal(b, &rec); err != nil {
+				invalid.Lines = append(invalid.Lines, line)
+				invalid.Errs = append(invalid.Errs, err)
+			} else {
+				records = append(records, rec)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return records, err
+		}
+	}
+
+	if len(invalid.Lines) > 0 {
+		return records, &invalid
+	}
+	return records, nil
+}
+
+// AuditLogError is returned by ReadAuditLog for the lines it skipped
+type AuditLogError struct {
+	Lines []int
+	Errs  []error
+}
+
+func (e *AuditLogError) Error() string {
+	msgs := make([]string, len(e.Lines))
+	for i, line := range e.Lines {
+		msgs[i] = fmt.Sprintf("line %d: %s", line, e.Errs[i])
+	}
+	return fmt.Sprintf("skipped %d invalid audit records: %s", len(e.Lines), strings.Join(msgs, "; "))
+}
+
+// Replay evaluates recorded requests against the current policy of the
+// Authorizer and returns the results in the same order. The requests are
+// evaluated as recorded, without calling the SubjectResolver or AuditSink.
+func (a *Authorizer) Replay(records []AuditRecord) []Result {
+	results := make([]Result, len(records))
+	for i, rec := range records {
+		results[i] = a.evalRequest(rec.Request)
+	}
+	return results
+}
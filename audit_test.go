@@ -0,0 +1,160 @@
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestRequestEncoding tests the JSON and YAML encoding of requests
+func TestRequestEncoding(t *testing.T) {
+	req := Request{
+		Verb:     "get",
+		Subjects: []Subject{{Name: "bofh", Kind: User}, {Name: "admins", Kind: Group}},
+		Resource: Resource{Namespace: "linux", APIGroup: "batch", Resource: "jobs", Subresource: "logs", ResourceName: "backup",
+			Attributes: map[string]string{"owner": "bofh"}},
+		Extra: map[string]string{"ip": "10.0.0.1"},
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal failed with %q", err)
+	}
+	if !strings.Contains(string(b), `{"kind":"User","name":"bofh"}`) {
+		t.Errorf("Subject kind should be encoded as string: %s", b)
+	}
+
+	var decoded Request
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed with %q", err)
+	}
+	if !reflect.DeepEqual(req, decoded) {
+		t.Errorf("JSON round trip changed the request: %+v", decoded)
+	}
+
+	y, err := yaml.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal failed with %q", err)
+	}
+	decoded = Request{}
+	if err := yaml.Unmarshal(y, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed with %q", err)
+	}
+	if !reflect.DeepEqual(req, decoded) {
+		t.Errorf("YAML round trip changed the request: %+v", decoded)
+	}
+
+	if err := json.Unmarshal([]byte(`{"verb":"get","subjects":[{"kind":"Robot","name":"x"}]}`), &decoded); err == nil {
+		t.Error("Unmarshal should fail for an unknown subject kind")
+	}
+}
+
+// TestAuditLogReplay tests recording requests and replaying them against a changed policy
+func TestAuditLogReplay(t *testing.T) {
+	a := New()
+	err := a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"jobs"},
+		Condition: `cidr(extra.ip, "10.0.0.0/8")`}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "readers", Role: "reader", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	now := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	a.SetClock(func() time.Time { return now })
+	buf := &bytes.Buffer{}
+	a.SetAuditSink(NewAuditLog(buf))
+
+	bofh := []Subject{{Name: "bofh", Kind: User}}
+	requests := []Request{
+		{Verb: "get", Subjects: bofh, Resource: Resource{Resource: "jobs"}, Extra: map[string]string{"ip": "10.0.0.1"}},
+		{Verb: "get", Subjects: bofh, Resource: Resource{Resource: "jobs"}, Extra: map[string]string{"ip": "192.168.0.1"}},
+		{Verb: "get", Subjects: bofh, Path: "/healthz"},
+	}
+	for i, req := range requests {
+		res, err := a.EvalContext(context.Background(), req)
+		if err != nil {
+			t.Fatalf("EvalContext failed with %q", err)
+		}
+		if res.Success != (i == 0) {
+			t.Errorf("Unexpected result %s", res)
+		}
+		if !reflect.DeepEqual(res.Request, req) {
+			t.Errorf("Result should contain the request, got %+v", res.Request)
+		}
+	}
+
+	records, err := ReadAuditLog(buf)
+	if err != nil {
+		t.Fatalf("ReadAuditLog failed with %q", err)
+	}
+	if len(records) != 3 || !records[0].Allowed || records[0].RoleBinding != "readers" || records[1].Allowed {
+		t.Fatalf("Unexpected records %+v", records)
+	}
+	if !records[0].Time.Equal(now) {
+		t.Errorf("Records should be timestamped by the clock of the Authorizer, got %s", records[0].Time)
+	}
+
+	// Replay against a changed policy
+	a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"jobs"}}}})
+	results := a.Replay(records)
+	if len(results) != 3 || !results[0].Success || !results[1].Success || results[2].Success {
+		t.Fatalf("Unexpected replay results %v", results)
+	}
+
+	// A log shared by Authorizers with different clocks and a wrapping sink
+	// timestamp every record with the clock of the deciding Authorizer
+	buf.Reset()
+	log := NewAuditLog(buf)
+	b := New()
+	b.SetClock(func() time.Time { return now.Add(time.Hour) })
+	b.SetAuditSink(wrappedAuditSink{log})
+	a.SetAuditSink(log)
+	b.EvalNonResource("get", bofh, "/healthz")
+	a.EvalNonResource("get", bofh, "/healthz")
+	b.EvalBatch(bofh, []VerbResource{{Verb: "get", Resource: Resource{Resource: "jobs"}}})
+	records, err = ReadAuditLog(buf)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("Unexpected records %+v, %v", records, err)
+	}
+	for i, expected := range []time.Time{now.Add(time.Hour), now, now.Add(time.Hour)} {
+		if !records[i].Time.Equal(expected) {
+			t.Errorf("Record %d should be timestamped %s, got %s", i, expected, records[i].Time)
+		}
+	}
+}
+
+// wrappedAuditSink is an AuditSink that passes the decisions on
+type wrappedAuditSink struct {
+	AuditSink
+}
+
+// TestReadAuditLogInvalid tests that invalid lines of an audit log are skipped
+// and reported
+func TestReadAuditLogInvalid(t *testing.T) {
+	log := `{"time":"2020-03-04T10:00:00Z","request":{"verb":"get","subjects":[{"kind":"User","name":"bofh"}]},"allowed":false}
+{"time":"2020-03-04T10:00:01Z","request":{"verb":"get","subjects":[{"kind":"Robot","name":"x"}]},"allowed":false}
+
+{"time":"2020-03-04T10:00:02Z","request":{"verb":"delete"
+{"time":"2020-03-04T10:00:03Z","request":{"verb":"list","subjects":[]},"allowed":false}`
+
+	records, err := ReadAuditLog(strings.NewReader(log))
+	e, ok := err.(*AuditLogError)
+	if !ok || !reflect.DeepEqual(e.Lines, []int{2, 4}) {
+		t.Fatalf("Expected AuditLogError for lines 2 and 4, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "line 2: ") {
+		t.Errorf("Error should name the line: %s", err)
+	}
+	if len(records) != 2 || records[0].Request.Verb != "get" || records[1].Request.Verb != "list" {
+		t.Errorf("Valid records should be returned, got %+v", records)
+	}
+}
@@ -0,0 +1,103 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VerbResource represents a single item of a batch evaluation
+type VerbResource struct {
+	Verb     string
+	Resource Resource
+}
+
+// EvalBatch evaluates many requests of the same subjects at once. The
+// RoleBindings of the subjects are matched once and all items are evaluated
+// against them, which is faster than calling Eval for every item. The results
+// are returned in the order of the items. Errors of the SubjectResolver or
+// AuditSink result in denied requests, use EvalBatchContext to handle them.
+func (a *Authorizer) EvalBatch(subject []Subject, items []VerbResource) []Result {
+	results, _ := a.EvalBatchContext(context.Background(), subject, items)
+	return results
+}
+
+// EvalBatchContext is the same as EvalBatch but passes the context to the
+// SubjectResolver and AuditSink like EvalContext. The decision cache isn't used.
+func (a *Authorizer) EvalBatchContext(ctx context.Context, subject []Subject, items []VerbResource) ([]Result, error) {
+	requests := make([]Request, len(items))
+	for i, item := range items {
+		requests[i] = Request{Verb: item.Verb, Subjects: subject, Resource: item.Resource}
+	}
+
+	denied := func(err error) ([]Result, error) {
+		results := make([]Result, len(requests))
+		for i, req := range requests {
+			results[i] = req.result()
+		}
+		return results, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return denied(err)
+	}
+
+	a.RLock()
+	resolver, sink, metrics := a.resolver, a.audit, a.metrics
+	a.RUnlock()
+
+	if resolver != nil {
+		subjects, err := resolver.ResolveSubjects(ctx, subject)
+		if err != nil {
+			return denied(fmt.Errorf("resolving subjects failed: %w", err))
+		}
+		for i := range requests {
+			requests[i].Subjects = subjects
+		}
+		subject = subjects
+
+		if err := ctx.Err(); err != nil {
+			return denied(err)
+		}
+	}
+
+	results := make([]Result, len(requests))
+	a.RLock()
+	var now time.Time
+	grants := a.grants(subject, &now)
+	for i, req := range requests {
+		start := time.Now()
+		results[i] = a.evalGrants(req, grants, &now)
+		observe(metrics, results[i], start)
+	}
+	decided := a.lazyNow(&now)
+	a.RUnlock()
+
+	if sink != nil {
+		for i, req := range requests {
+			if err := sink.Audit(ctx, req, results[i], decided); err != nil {
+				return denied(fmt.Errorf("auditing failed: %w", err))
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// Filter returns the names out of `names` for which the subjects are allowed to
+// apply the verb to the resource. The ResourceName of `resource` is ignored.
+func (a *Authorizer) Filter(subject []Subject, verb string, resource Resource, names []string) []string {
+	items := make([]VerbResource, len(names))
+	for i, name := range names {
+		items[i] = VerbResource{Verb: verb, Resource: resource}
+		items[i].Resource.ResourceName = name
+	}
+
+	ret := []string{}
+	for i, res := range a.EvalBatch(subject, items) {
+		if res.Success {
+			ret = append(ret, names[i])
+		}
+	}
+	return ret
+}
@@ -0,0 +1,65 @@
+package rbac
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestEvalBatch tests that batch evaluation equals single evaluation for all
+// permutations of a subset of the extensive test data
+func TestEvalBatch(t *testing.T) {
+	a := createExtensiveAuthorizer()
+
+	subjects := [][]Subject{
+		{{Name: "bofh", Kind: User}},
+		{{Name: "superusers", Kind: Group}, {Name: "auditor", Kind: ServiceAccount}},
+		{{Name: "nobody", Kind: User}},
+	}
+
+	var items []VerbResource
+	for _, verb := range []string{"get", "list", "update", "delete"} {
+		for _, ns := range []string{"", "linux", "windows"} {
+			for _, res := range []string{"nodes", "locations", "nodes/states"} {
+				for _, name := range []string{"", "linux"} {
+					items = append(items, VerbResource{verb, Resource{Namespace: ns, Resource: res, ResourceName: name}})
+				}
+			}
+		}
+	}
+
+	for _, subject := range subjects {
+		results := a.EvalBatch(subject, items)
+		if len(results) != len(items) {
+			t.Fatalf("Expected %d results, got %d", len(items), len(results))
+		}
+
+		for i, item := range items {
+			expected := a.Eval(item.Verb, subject, item.Resource)
+			if results[i].Success != expected.Success || results[i].RoleBinding != expected.RoleBinding ||
+				!reflect.DeepEqual(results[i].Request, expected.Request) {
+				t.Errorf("Batch result %s differs from %s", results[i], expected)
+			}
+		}
+	}
+}
+
+// TestFilter tests filtering resource names by permission
+func TestFilter(t *testing.T) {
+	a := createExtensiveAuthorizer()
+	names := []string{"linux", "windows", "bsd"}
+
+	got := a.Filter([]Subject{{Name: "bofh", Kind: User}}, "update", Resource{Namespace: "linux", Resource: "nodes/states"}, names)
+	if !reflect.DeepEqual(got, []string{"linux"}) {
+		t.Errorf("Expected only linux, got %q", got)
+	}
+
+	got = a.Filter([]Subject{{Name: "bofh", Kind: User}}, "get", Resource{Namespace: "linux", Resource: "nodes"}, names)
+	if !reflect.DeepEqual(got, names) {
+		t.Errorf("Expected all names, got %q", got)
+	}
+
+	got = a.Filter([]Subject{{Name: "nobody", Kind: User}}, "get", Resource{Namespace: "linux", Resource: "nodes"}, names)
+	if len(got) != 0 {
+		t.Errorf("Expected no names, got %q", got)
+	}
+}
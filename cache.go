@@ -0,0 +1,318 @@
+package rbac
+
+import (
+	"container/list"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures the decision cache of an Authorizer. Allowed and
+// denied decisions are cached separately, a size of zero disables caching of
+// the respective decisions. Cached decisions are dropped on every policy change
+// and after their TTL, or as soon as a RoleBinding of the requesting subjects
+// becomes valid or expires if that is earlier. A TTL of zero means no limit.
+// Decisions of requests that match a rule with a condition aren't cached, as
+// the condition may depend on the time.
+type CacheConfig struct {
+	Size         int
+	TTL          time.Duration
+	NegativeSize int
+	NegativeTTL  time.Duration
+}
+
+// CacheStats represents the counters of the decision cache. Hits include the
+// NegativeHits of denied decisions.
+type CacheStats struct {
+	Hits         uint64
+	Misses       uint64
+	NegativeHits uint64
+	Size         int
+	NegativeSize int
+}
+
+// SetCache enables the LRU decision cache or reconfigures it. Passing a zero
+// CacheConfig disables the cache.
+func (a *Authorizer) SetCache(c CacheConfig) {
+	a.Lock()
+	defer a.Unlock()
+
+	if c.Size <= 0 && c.NegativeSize <= 0 {
+		a.cache = nil
+		return
+	}
+
+	a.cache = &decisionCache{
+		gen:      a.generation,
+		positive: newLRU(c.Size, c.TTL),
+		negative: newLRU(c.NegativeSize, c.NegativeTTL),
+	}
+}
+
+// CacheStats returns the counters of the decision cache
+func (a *Authorizer) CacheStats() CacheStats {
+	a.RLock()
+	c := a.cache
+	a.RUnlock()
+
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	stats := c.stats
+	stats.Size = c.positive.ll.Len()
+	stats.NegativeSize = c.negative.ll.Len()
+	return stats
+}
+
+// evalCached evaluates a request using the decision cache. Decisions are only
+// added if the policy didn't change since `gen`.
+func (a *Authorizer) evalCached(c *decisionCache, gen uint64, req Request) Result {
+	key := req.cacheKey()
+	now := a.now()
+
+	c.Lock()
+	res, ok := c.get(key, now)
+	c.Unlock()
+	if ok {
+		res.Request = req
+		res.RequestedVerb = req.Verb
+		res.RequestingSubject = req.Subjects
+		res.RequestedResource = req.Resource
+
+		// The key ignores the order of the subjects, but the granting subject
+		// depends on it
+		if res.Success {
+			a.RLock()
+			rb, ok := a.rolebindings[res.RoleBinding]
+			a.RUnlock()
+			if !ok {
+				return a.evalRequest(req)
+			}
+			subject, _ := matchSubjects(rb.Subjects, req.Subjects)
+			res.Subject, res.SubjectType = subject.Name, subject.Kind
+		}
+		return res
+	}
+
+	res = a.evalRequest(req)
+
+	a.RLock()
+	cacheable, expires := a.cacheBounds(req, now)
+	a.RUnlock()
+	if !cacheable {
+		return res
+	}
+
+	c.Lock()
+	c.add(gen, key, res, now, expires)
+	c.Unlock()
+	return res
+}
+
+// cacheBounds returns if the decision of a request may be cached and when it
+// may change because a time bounded RoleBinding of the subjects becomes valid
+// or expires. The expiry is zero if there is no such RoleBinding. Decisions
+// can't be cached if a rule with a condition matches the request. The caller
+// must hold the read lock.
+func (a *Authorizer) cacheBounds(req Request, now time.Time) (bool, time.Time) {
+	var expires time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && t.After(now) && (expires.IsZero() || t.Before(expires)) {
+			expires = t
+		}
+	}
+
+	namespace := req.Resource.Namespace
+	if req.Path != "" {
+		namespace = ""
+	}
+	ancestors := a.ancestors(namespace)
+	ruleOk := ruleMatcher(req)
+	for _, g := range a.grants(req.Subjects, nil) {
+		earliest(g.binding.NotBefore)
+		earliest(g.binding.NotAfter)
+
+		if _, scopeOk := a.matchScope(g.binding, namespace, ancestors); !scopeOk {
+			continue
+		}
+		for i, rule := range g.role.Rules {
+			if g.conditions[i] != nil && ruleOk(rule) {
+				return false, time.Time{}
+			}
+		}
+	}
+	return true, expires
+}
+
+// decisionCache holds allowed and denied decisions in separate LRU caches
+type decisionCache struct {
+	sync.Mutex
+	gen      uint64
+	positive *lru
+	negative *lru
+	stats    CacheStats
+}
+
+// get returns a cached decision and updates the counters. Positive decisions
+// are looked up first as they are usually more frequent.
+func (c *decisionCache) get(key string, now time.Time) (Result, bool) {
+	if res, ok := c.positive.get(key, now); ok {
+		c.stats.Hits++
+		return res, true
+	}
+
+	if res, ok := c.negative.get(key, now); ok {
+		c.stats.Hits++
+		c.stats.NegativeHits++
+		return res, true
+	}
+
+	c.stats.Misses++
+	return Result{}, false
+}
+
+// add caches a decision until `expires` if it was evaluated for the current
+// generation
+func (c *decisionCache) add(gen uint64, key string, res Result, now, expires time.Time) {
+	if gen != c.gen {
+		return
+	}
+
+	if res.Success {
+		c.positive.add(key, res, now, expires)
+	} else {
+		c.negative.add(key, res, now, expires)
+	}
+}
+
+// reset drops all decisions because the policy changed to generation `gen`
+func (c *decisionCache) reset(gen uint64) {
+	c.Lock()
+	c.gen = gen
+	c.positive.clear()
+	c.negative.clear()
+	c.Unlock()
+}
+
+// lru is a size limited cache that evicts the least recently used entry.
+// It isn't safe for concurrent use.
+type lru struct {
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	res     Result
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (l *lru) get(key string, now time.Time) (Result, bool) {
+	e, ok := l.entries[key]
+	if !ok {
+		return Result{}, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !now.Before(entry.expires) {
+		l.ll.Remove(e)
+		delete(l.entries, key)
+		return Result{}, false
+	}
+
+	l.ll.MoveToFront(e)
+	return entry.res, true
+}
+
+// add inserts a decision that expires after the TTL or at `expires` if it is
+// earlier and not zero
+func (l *lru) add(key string, res Result, now, expires time.Time) {
+	if l.size <= 0 {
+		return
+	}
+
+	if l.ttl > 0 && (expires.IsZero() || now.Add(l.ttl).Before(expires)) {
+		expires = now.Add(l.ttl)
+	}
+
+	if e, ok := l.entries[key]; ok {
+		l.ll.MoveToFront(e)
+		e.Value = &lruEntry{key: key, res: res, expires: expires}
+		return
+	}
+
+	l.entries[key] = l.ll.PushFront(&lruEntry{key: key, res: res, expires: expires})
+	if l.ll.Len() > l.size {
+		oldest := l.ll.Back()
+		l.ll.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *lru) clear() {
+	l.ll.Init()
+	l.entries = map[string]*list.Element{}
+}
+
+// cacheKey returns a canonical representation of the request. The order and
+// duplicates of subjects don't change the key.
+func (r Request) cacheKey() string {
+	var b strings.Builder
+	write := func(s string) {
+		b.WriteString(strconv.Itoa(len(s)))
+		b.WriteByte(':')
+		b.WriteString(s)
+	}
+	writeMap := func(m map[string]string) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString(strconv.Itoa(len(keys)))
+		for _, k := range keys {
+			write(k)
+			write(m[k])
+		}
+	}
+
+	write(r.Verb)
+	write(r.Path)
+	write(r.Resource.Namespace)
+	write(r.Resource.APIGroup)
+	write(r.Resource.Resource)
+	write(r.Resource.Subresource)
+	write(r.Resource.ResourceName)
+	writeMap(r.Resource.Attributes)
+	writeMap(r.Extra)
+
+	subjects := make([]string, 0, len(r.Subjects))
+	for _, s := range r.Subjects {
+		subjects = append(subjects, strconv.Itoa(int(s.Kind))+":"+s.Name)
+	}
+	sort.Strings(subjects)
+	for i, s := range subjects {
+		if i == 0 || s != subjects[i-1] {
+			write(s)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,182 @@
+package rbac
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCacheKey tests the canonicalization of requests
+func TestCacheKey(t *testing.T) {
+	a := Request{Verb: "get", Subjects: []Subject{{Name: "bofh", Kind: User}, {Name: "admins", Kind: Group}},
+		Resource: Resource{Resource: "jobs", Attributes: map[string]string{"a": "1", "b": "2"}}}
+	b := Request{Verb: "get", Subjects: []Subject{{Name: "admins", Kind: Group}, {Name: "bofh", Kind: User}, {Name: "bofh", Kind: User}},
+		Resource: Resource{Resource: "jobs", Attributes: map[string]string{"b": "2", "a": "1"}}}
+	if a.cacheKey() != b.cacheKey() {
+		t.Errorf("Keys should be equal: %q != %q", a.cacheKey(), b.cacheKey())
+	}
+
+	different := []Request{
+		{Verb: "get", Subjects: a.Subjects, Resource: Resource{Resource: "jobs"}},
+		{Verb: "get", Subjects: []Subject{{Name: "bofh", Kind: Group}, {Name: "admins", Kind: Group}}, Resource: a.Resource},
+		{Verb: "get", Subjects: a.Subjects, Resource: Resource{Resource: "jobs", Attributes: map[string]string{"a": "12"}}},
+		{Verb: "get", Subjects: a.Subjects, Resource: Resource{Resource: "jobs", Attributes: map[string]string{"a": "1", "b": "2"}},
+			Extra: map[string]string{"ip": "10.0.0.1"}},
+		{Verb: "get", Subjects: a.Subjects, Resource: Resource{Namespace: "jobs"}},
+	}
+	for _, d := range different {
+		if d.cacheKey() == a.cacheKey() {
+			t.Errorf("Keys should differ for %+v", d)
+		}
+	}
+}
+
+// TestRBACCache tests caching and invalidation of decisions
+func TestRBACCache(t *testing.T) {
+	now := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	a := New()
+	a.SetClock(func() time.Time { return now })
+	a.SetCache(CacheConfig{Size: 2, TTL: time.Minute, NegativeSize: 10, NegativeTTL: time.Second})
+
+	err := a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"jobs", "nodes", "pods"}}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "readers", Role: "reader", Subjects: []Subject{{Name: "bofh", Kind: User}},
+		NotAfter: now.Add(30 * time.Second)})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	bofh := []Subject{{Name: "bofh", Kind: User}}
+	jobs := Resource{Resource: "jobs"}
+	for i := 0; i < 3; i++ {
+		if res := a.Eval("get", bofh, jobs); !res.Success {
+			t.Fatalf("Should validate, but didn't: %s", res)
+		}
+		if res := a.Eval("delete", bofh, jobs); res.Success {
+			t.Fatalf("Should not validate, but did: %s", res)
+		}
+	}
+	if stats := a.CacheStats(); stats.Hits != 4 || stats.NegativeHits != 2 || stats.Misses != 2 || stats.Size != 1 || stats.NegativeSize != 1 {
+		t.Fatalf("Unexpected cache stats %+v", stats)
+	}
+
+	// Cached results carry the request of the caller
+	other := []Subject{{Name: "bofh", Kind: User}, {Name: "bofh", Kind: User}}
+	if res := a.Eval("get", other, jobs); len(res.Request.Subjects) != 2 {
+		t.Errorf("Cached result should contain the new request: %+v", res.Request)
+	}
+
+	// LRU eviction
+	a.Eval("get", bofh, Resource{Resource: "nodes"})
+	a.Eval("get", bofh, Resource{Resource: "pods"})
+	if stats := a.CacheStats(); stats.Size != 2 {
+		t.Fatalf("Cache should be limited to two entries: %+v", stats)
+	}
+
+	// Negative TTL
+	now = now.Add(2 * time.Second)
+	before := a.CacheStats()
+	a.Eval("delete", bofh, jobs)
+	if stats := a.CacheStats(); stats.Misses != before.Misses+1 {
+		t.Fatalf("Negative decision should have expired: %+v", stats)
+	}
+
+	// Decisions expire with the RoleBinding
+	now = now.Add(30 * time.Second)
+	if res := a.Eval("get", bofh, Resource{Resource: "pods"}); res.Success {
+		t.Fatalf("Cached decision should expire with the RoleBinding: %s", res)
+	}
+
+	// Policy changes invalidate the cache
+	a.SetRoleBinding(RoleBinding{Name: "readers", Role: "reader", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if stats := a.CacheStats(); stats.Size != 0 || stats.NegativeSize != 0 {
+		t.Fatalf("Cache should be empty after a change: %+v", stats)
+	}
+	if res := a.Eval("get", bofh, jobs); !res.Success {
+		t.Fatalf("Should validate, but didn't: %s", res)
+	}
+	a.DeleteRole("reader")
+	if res := a.Eval("get", bofh, jobs); res.Success {
+		t.Fatalf("Should not validate after deleting the role: %s", res)
+	}
+
+	// Cached decisions are attributed to the subject Eval would choose
+	a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"jobs"}}}})
+	a.SetRoleBinding(RoleBinding{Name: "readers", Role: "reader", Subjects: []Subject{{Name: "bofh", Kind: User}, {Name: "admins", Kind: Group}}})
+	a.Eval("get", []Subject{{Name: "bofh", Kind: User}, {Name: "admins", Kind: Group}}, jobs)
+	if res := a.Eval("get", []Subject{{Name: "admins", Kind: Group}, {Name: "bofh", Kind: User}}, jobs); res.Subject != "bofh" || res.SubjectType != User {
+		t.Errorf("Cached decision should be attributed to bofh: %s", res)
+	}
+
+	a.SetCache(CacheConfig{})
+	if stats := a.CacheStats(); stats != (CacheStats{}) {
+		t.Errorf("Disabled cache should have no stats: %+v", stats)
+	}
+}
+
+// TestRBACCacheTime tests that cached decisions don't outlive conditions and
+// the validity of RoleBindings
+func TestRBACCacheTime(t *testing.T) {
+	now := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	a := New()
+	a.SetClock(func() time.Time { return now })
+	a.SetCache(CacheConfig{Size: 10, NegativeSize: 10})
+
+	err := a.SetRole(Role{Name: "office", Rules: []Rule{{
+		Verbs:     []string{"delete"},
+		Resources: []string{"documents"},
+		Condition: "hour() >= 9 && hour() < 17",
+	}, {
+		Verbs:     []string{"get"},
+		Resources: []string{"documents"},
+	}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "office", Role: "office", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	bofh := []Subject{{Name: "bofh", Kind: User}}
+	docs := Resource{Resource: "documents"}
+	if res := a.Eval("delete", bofh, docs); !res.Success {
+		t.Fatalf("Should validate during office hours, but didn't: %s", res)
+	}
+	now = now.Add(10 * time.Hour)
+	if res := a.Eval("delete", bofh, docs); res.Success {
+		t.Fatalf("Should not validate from the cache after office hours: %s", res)
+	}
+	now = now.Add(-10 * time.Hour)
+	if res := a.Eval("delete", bofh, docs); !res.Success {
+		t.Fatalf("Should validate again during office hours, but didn't: %s", res)
+	}
+	if stats := a.CacheStats(); stats.Hits != 0 || stats.Size != 0 || stats.NegativeSize != 0 {
+		t.Errorf("Decisions depending on a condition should not be cached: %+v", stats)
+	}
+
+	a.Eval("get", bofh, docs)
+	if res := a.Eval("get", bofh, docs); !res.Success || a.CacheStats().Hits != 1 {
+		t.Errorf("Decisions without conditions should be cached: %s, %+v", res, a.CacheStats())
+	}
+
+	// Denied decisions are only cached until a RoleBinding becomes valid
+	err = a.SetRoleBinding(RoleBinding{Name: "later", Role: "office", Subjects: []Subject{{Name: "alice", Kind: User}},
+		NotBefore: now.Add(time.Hour), NotAfter: now.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+	alice := []Subject{{Name: "alice", Kind: User}}
+	if res := a.Eval("get", alice, docs); res.Success {
+		t.Fatalf("Should not validate before NotBefore: %s", res)
+	}
+	now = now.Add(time.Hour)
+	if res := a.Eval("get", alice, docs); !res.Success {
+		t.Fatalf("Should validate after NotBefore, but didn't: %s", res)
+	}
+	now = now.Add(time.Hour)
+	if res := a.Eval("get", alice, docs); res.Success {
+		t.Fatalf("Should not validate after NotAfter: %s", res)
+	}
+}
@@ -0,0 +1,219 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCheckerNamespaces limits the number of namespace indexes a Checker keeps
+// before it starts over
+const maxCheckerNamespaces = 1024
+
+// Checker evaluates requests of fixed subjects, for example those of a
+// long-lived connection. The RoleBindings of the subjects are matched once and
+// their rules are indexed per namespace by verb, API group and resource, so a
+// check only looks up the matching rules. The Checker refreshes itself on the
+// next check after the policy of its Authorizer changed and returns the same
+// Results as Eval. A Checker is safe for concurrent use.
+type Checker struct {
+	sync.Mutex
+	authz      *Authorizer
+	subjects   []Subject
+	generation uint64
+	grants     []grant
+	namespaces map[string]*checkerIndex
+}
+
+// checkerIndex holds the rules of the grants applying to a namespace
+type checkerIndex struct {
+	scope map[int]string           // granting namespace by grant
+	rules map[string][]checkerRule // rules by verb, API group and resource
+}
+
+// checkerRule references rule `rule` of grant `grant`
+type checkerRule struct {
+	grant int
+	rule  int
+}
+
+// For returns a Checker for the given subjects. The subjects are used as they
+// are, the SubjectResolver isn't called. The AuditSink and the decision cache
+// aren't used by the Checker either.
+func (a *Authorizer) For(subject []Subject) *Checker {
+	return &Checker{
+		authz:    a,
+		subjects: subject,
+	}
+}
+
+// Subjects returns the subjects of the Checker
+func (c *Checker) Subjects() []Subject {
+	return c.subjects
+}
+
+// Check evaluates if the subjects of the Checker may apply `verb` to the
+// resource like Eval does
+func (c *Checker) Check(verb string, resource Resource) Result {
+	return c.CheckRequest(Request{Verb: verb, Resource: resource})
+}
+
+// CheckNonResource evaluates if the subjects of the Checker may apply `verb`
+// to the non-resource URL `path` like EvalNonResource does. An empty path is
+// denied.
+func (c *Checker) CheckNonResource(verb string, path string) Result {
+	if path == "" {
+		return Request{Verb: verb, Subjects: c.subjects}.result()
+	}
+	return c.CheckRequest(Request{Verb: verb, Path: path})
+}
+
+// CheckRequest evaluates a request like EvalContext does. The subjects of the
+// request are replaced by the subjects of the Checker.
+func (c *Checker) CheckRequest(req Request) Result {
+	req.Subjects = c.subjects
+
+	c.Lock()
+	defer c.Unlock()
+	c.authz.RLock()
+	defer c.authz.RUnlock()
+
+	start := time.Now()
+	res := c.check(req)
+	observe(c.authz.metrics, res, start)
+	return res
+}
+
+// check evaluates a request. The caller must hold the lock and the read lock
+// of the Authorizer.
+func (c *Checker) check(req Request) Result {
+	a := c.authz
+	if c.grants == nil || c.generation != a.generation {
+		c.generation = a.generation
+		c.grants = a.grants(c.subjects, nil)
+		c.namespaces = map[string]*checkerIndex{}
+	}
+
+	var now time.Time
+	if req.Path != "" {
+		// Non-resource URLs are rare and only granted globally
+		var grants []grant
+		for _, g := range c.grants {
+			if !g.binding.timeBounded() || g.binding.validAt(a.lazyNow(&now)) {
+				grants = append(grants, g)
+			}
+		}
+		return a.evalGrants(req, grants, &now)
+	}
+
+	resource := req.Resource
+	idx := c.index(resource.Namespace)
+	env := condEnv{verb: req.Verb, resource: resource, extra: req.Extra}
+	res := req.result()
+	for _, r := range idx.lookup(req.Verb, resource) {
+		g := c.grants[r.grant]
+
+		// Check if rolebinding is valid at this time
+		if g.binding.timeBounded() && !g.binding.validAt(a.lazyNow(&now)) {
+			continue
+		}
+
+		if !sContains(g.role.Rules[r.rule].ResourceNames, resource.ResourceName, true) {
+			continue
+		}
+
+		subject, condOk := a.checkCondition(g, r.rule, &env, &now, &res)
+		if !condOk {
+			continue
+		}
+
+		return g.granted(res, idx.scope[r.grant], r.rule, subject)
+	}
+
+	return res
+}
+
+// index returns the index of the rules applying to the namespace and builds it
+// first if needed. The caller must hold the lock and the read lock of the
+// Authorizer.
+func (c *Checker) index(namespace string) *checkerIndex {
+	if idx, ok := c.namespaces[namespace]; ok {
+		return idx
+	}
+
+	if len(c.namespaces) >= maxCheckerNamespaces {
+		c.namespaces = map[string]*checkerIndex{}
+	}
+
+	idx := &checkerIndex{
+		scope: map[int]string{},
+		rules: map[string][]checkerRule{},
+	}
+	ancestors := c.authz.ancestors(namespace)
+	for i, g := range c.grants {
+		scope, ok := c.authz.matchScope(g.binding, namespace, ancestors)
+		if !ok {
+			continue
+		}
+		idx.scope[i] = scope
+
+		for j, rule := range g.role.Rules {
+			groups := rule.APIGroups
+			if len(groups) == 0 {
+				groups = []string{""}
+			}
+			for _, verb := range rule.Verbs {
+				for _, group := range groups {
+					for _, resource := range rule.Resources {
+						key := checkerKey(verb, group, resource)
+						idx.rules[key] = append(idx.rules[key], checkerRule{grant: i, rule: j})
+					}
+				}
+			}
+		}
+	}
+
+	c.namespaces[namespace] = idx
+	return idx
+}
+
+// lookup returns the rules matching the verb, API group and resource of the
+// request in the order Eval would evaluate them. Resource names and conditions
+// are left to the caller.
+func (idx *checkerIndex) lookup(verb string, resource Resource) []checkerRule {
+	requested := resource.path()
+	resources := []string{requested, "*"}
+	if i := strings.IndexByte(requested, '/'); i >= 0 {
+		resources = append(resources, requested[:i+1]+"*", "*"+requested[i:])
+	}
+
+	var ret []checkerRule
+	for _, group := range []string{resource.APIGroup, "*"} {
+		for _, r := range resources {
+			ret = append(ret, idx.rules[checkerKey(verb, group, r)]...)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].grant != ret[j].grant {
+			return ret[i].grant < ret[j].grant
+		}
+		return ret[i].rule < ret[j].rule
+	})
+
+	// A rule can match by more than one key
+	var n int
+	for i := range ret {
+		if i == 0 || ret[i] != ret[n-1] {
+			ret[n] = ret[i]
+			n++
+		}
+	}
+	return ret[:n]
+}
+
+// checkerKey returns the index key of a verb, API group and resource
+func checkerKey(verb, group, resource string) string {
+	return verb + "\x00" + group + "\x00" + resource
+}
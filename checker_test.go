@@ -0,0 +1,122 @@
+package rbac
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestChecker tests that a Checker returns the same results as Eval for
+// wildcards, API groups, subresources, conditions, namespace hierarchies and
+// expiring RoleBindings
+func TestChecker(t *testing.T) {
+	a := createExtensiveAuthorizer()
+	now := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	a.SetClock(func() time.Time { return now })
+	a.SetNamespaceParent(PathNamespaceParent("/"))
+
+	roles := []Role{{
+		Name: "wildcards",
+		Rules: []Rule{
+			{Verbs: []string{"get"}, APIGroups: []string{"*"}, Resources: []string{"*"}, ResourceNames: []string{"linux"}},
+			{Verbs: []string{"update"}, APIGroups: []string{"apps", ""}, Resources: []string{"nodes/*", "*/states"}},
+			{Verbs: []string{"delete"}, Resources: []string{"locations"}, Condition: `attr.owner == subject.name`},
+			{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz", "/debug/*"}},
+		},
+	}}
+	for _, role := range roles {
+		if err := a.SetRole(role); err != nil {
+			t.Fatalf("SetRole failed with %q", err)
+		}
+	}
+
+	bindings := []RoleBinding{{
+		Name:     "a-wildcards",
+		Role:     "wildcards",
+		Subjects: []Subject{{Name: "bofh", Kind: User}},
+	}, {
+		Name:      "b-team",
+		Role:      "wildcards",
+		Namespace: "team",
+		Subjects:  []Subject{{Name: "developers", Kind: Group}},
+	}, {
+		Name:      "c-expired",
+		Role:      "readonly",
+		Subjects:  []Subject{{Name: "developers", Kind: Group}},
+		NotBefore: now.Add(-2 * time.Hour),
+		NotAfter:  now.Add(time.Hour),
+	}}
+	for _, rb := range bindings {
+		if err := a.SetRoleBinding(rb); err != nil {
+			t.Fatalf("SetRoleBinding failed with %q", err)
+		}
+	}
+
+	subjects := [][]Subject{
+		{{Name: "bofh", Kind: User}},
+		{{Name: "alice", Kind: User}, {Name: "developers", Kind: Group}},
+		{{Name: "superusers", Kind: Group}, {Name: "auditor", Kind: ServiceAccount}},
+		{{Name: "nobody", Kind: User}},
+	}
+
+	var resources []Resource
+	for _, ns := range []string{"", "linux", "team", "team/dev"} {
+		for _, group := range []string{"", "apps"} {
+			for _, res := range []string{"nodes", "locations", "nodes/states", "nodes/logs", "pods/states"} {
+				for _, name := range []string{"", "linux"} {
+					resources = append(resources, Resource{Namespace: ns, APIGroup: group, Resource: res, ResourceName: name,
+						Attributes: map[string]string{"owner": "bofh"}})
+				}
+			}
+		}
+	}
+
+	compare := func() {
+		for _, subject := range subjects {
+			c := a.For(subject)
+			for _, verb := range []string{"get", "list", "update", "delete"} {
+				for _, resource := range resources {
+					got, expected := c.Check(verb, resource), a.Eval(verb, subject, resource)
+					if !reflect.DeepEqual(got, expected) {
+						t.Errorf("Checker result %s differs from %s", got, expected)
+					}
+				}
+			}
+
+			for _, path := range []string{"/healthz", "/debug/pprof", "/metrics"} {
+				got, expected := c.CheckNonResource("get", path), a.EvalNonResource("get", subject, path)
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("Checker result %s differs from %s", got, expected)
+				}
+			}
+		}
+	}
+
+	compare()
+	now = now.Add(2 * time.Hour)
+	compare()
+}
+
+// TestCheckerRefresh tests that a Checker follows changes of the policy
+func TestCheckerRefresh(t *testing.T) {
+	a := createExtensiveAuthorizer()
+	c := a.For([]Subject{{Name: "nobody", Kind: User}})
+	resource := Resource{Namespace: "linux", Resource: "nodes"}
+
+	if res := c.Check("get", resource); res.Success {
+		t.Fatalf("Should not validate before binding: %s", res)
+	}
+
+	err := a.SetRoleBinding(RoleBinding{Name: "nobody-reads", Role: "readonly", Subjects: []Subject{{Name: "nobody", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+	if res := c.Check("get", resource); !res.Success || res.RoleBinding != "nobody-reads" {
+		t.Fatalf("Should validate after binding, but didn't: %s", res)
+	}
+
+	a.DeleteRole("readonly")
+	if res := c.Check("get", resource); res.Success {
+		t.Fatalf("Should not validate after deleting the role: %s", res)
+	}
+}
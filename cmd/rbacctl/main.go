@@ -0,0 +1,656 @@
+// Command rbacctl validates, queries and formats policy files. Policies are
+// read from the YAML and JSON files and directories given by `-f`, see
+// rbac.ReadPolicy. Run `rbacctl help` for the list of commands.
+//
+// The exit status is 0 on success, 1 if a request is denied, a policy is
+// invalid or policies differ and 2 on usage errors and other failures.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/djboris9/rbac"
+	"github.com/djboris9/rbac/rbactest"
+	"gopkg.in/yaml.v3"
+)
+
+// command represents a subcommand. `run` returns the exit status.
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(fs *flag.FlagSet, args []string, w io.Writer) (int, error)
+}
+
+var commands = []command{
+	{"validate", "[-f policy]...", "load the policy and report errors", validate},
+	{"can-i", "[flags] <verb> <resource>|<path>", "evaluate a request", canI},
+	{"explain", "[flags] <verb> <resource>|<path>", "explain the evaluation of a request per RoleBinding", explain},
+	{"who-can", "[-f policy]... [-n namespace] [--name n] [--subresource s] <verb> <resource>|<path>", "list the subjects that are granted a request", whoCan},
+	{"list-rules", "[flags]", "list the rules that apply to subjects in a namespace", listRules},
+	{"diff", "[-o text|json] <old> <new>", "compare two policy files or directories", diff},
+	{"matrix", "[-f policy]...", "print the effective permission matrix", matrix},
+	{"fmt", "[-w] <file>...", "normalize policy files", format},
+	{"check", "[-f policy]... [-o text|json] <invariant file>...", "check invariants and report counterexamples", check},
+	{"test", "[-f policy]... [-v] <test file>...", "run declarative test cases, see package rbactest", test},
+}
+
+var (
+	errUsage = errors.New("invalid usage")
+
+	// errFlags is returned for flags the flag package already reported
+	errFlags = errors.New("invalid flags")
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command of args and returns the exit status. The results are
+// written to stdout, errors and usage to stderr.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 1 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		return 2
+	}
+
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+
+		c := c
+		fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: rbacctl %s %s\n\n%s\n\n", c.name, c.args, c.short)
+			fs.PrintDefaults()
+		}
+
+		code, err := c.run(fs, args[1:], stdout)
+		switch {
+		case err == flag.ErrHelp:
+			return 0
+		case err == errFlags:
+		case err == errUsage:
+			fs.Usage()
+		case err != nil:
+			fmt.Fprintf(stderr, "rbacctl %s: %s\n", c.name, err)
+		}
+		return code
+	}
+
+	fmt.Fprintf(stderr, "rbacctl: unknown command %q\n\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: rbacctl <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", c.name, c.short)
+	}
+	fmt.Fprintln(w, "\nRun `rbacctl <command> -h` for the flags of a command.")
+}
+
+// parseArgs parses the flags of fs and returns the positional arguments.
+// Unlike fs.Parse it accepts flags after and between the positional
+// arguments, so `rbacctl can-i get nodes --as bofh` works too. Arguments after
+// `--` are positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return nil, err
+		} else if err != nil {
+			return nil, errFlags
+		}
+
+		parsed := len(args) - fs.NArg()
+		if fs.NArg() == 0 || parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, fs.Args()...), nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// subjectList is a flag of subjects in the form `kind:name`
+type subjectList []rbac.Subject
+
+func (l *subjectList) String() string {
+	s := make([]string, len(*l))
+	for i, subject := range *l {
+		s[i] = subject.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *subjectList) Set(s string) error {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return fmt.Errorf("expected kind:name, got %q", s)
+	}
+
+	var subject rbac.Subject
+	if err := subject.Kind.Set(s[:i]); err != nil {
+		return err
+	}
+	subject.Name = s[i+1:]
+	*l = append(*l, subject)
+	return nil
+}
+
+// mapFlag is a flag of `key=value` pairs
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	var s []string
+	for k, v := range m {
+		s = append(s, k+"="+v)
+	}
+	return strings.Join(s, ",")
+}
+
+func (m mapFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	m[s[:i]] = s[i+1:]
+	return nil
+}
+
+// policyFlags reads the policy given by `-f`
+type policyFlags struct {
+	paths stringList
+}
+
+func (p *policyFlags) register(fs *flag.FlagSet) {
+	fs.Var(&p.paths, "f", "policy `file` or directory, can be repeated (default .)")
+}
+
+func (p *policyFlags) read() (rbac.Policy, error) {
+	if len(p.paths) == 0 {
+		return rbac.ReadPolicy(".")
+	}
+	return rbac.ReadPolicy(p.paths...)
+}
+
+func (p *policyFlags) authorizer() (*rbac.Authorizer, error) {
+	policy, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+
+	a := rbac.New()
+	return a, a.SetPolicy(policy)
+}
+
+// requestFlags builds a request from the flags and the verb and resource
+// arguments
+type requestFlags struct {
+	policyFlags
+	users       stringList
+	groups      stringList
+	sas         stringList
+	subjects    subjectList
+	namespace   string
+	name        string
+	subresource string
+	attributes  mapFlag
+	extra       mapFlag
+}
+
+func (r *requestFlags) register(fs *flag.FlagSet, subjects bool) {
+	r.policyFlags.register(fs)
+	fs.StringVar(&r.namespace, "n", "", "`namespace` of the request, empty for the global scope")
+	fs.StringVar(&r.name, "name", "", "`name` of the requested resource")
+	if !subjects {
+		fs.StringVar(&r.subresource, "subresource", "", "`subresource` of the requested resource")
+		return
+	}
+
+	fs.Var(&r.users, "as", "requesting `user`, can be repeated")
+	fs.Var(&r.groups, "group", "requesting `group`, can be repeated")
+	fs.Var(&r.sas, "sa", "requesting `serviceaccount`, can be repeated")
+	fs.Var(&r.subjects, "subject", "requesting subject as `kind:name`, can be repeated")
+	fs.StringVar(&r.subresource, "subresource", "", "`subresource` of the requested resource")
+	r.attributes, r.extra = mapFlag{}, mapFlag{}
+	fs.Var(r.attributes, "attr", "resource attribute as `key=value` for conditions, can be repeated")
+	fs.Var(r.extra, "extra", "request attribute as `key=value` for conditions, can be repeated")
+}
+
+// requestSubjects returns the subjects of all subject flags
+func (r *requestFlags) requestSubjects() []rbac.Subject {
+	var ret []rbac.Subject
+	for _, name := range r.users {
+		ret = append(ret, rbac.Subject{Name: name, Kind: rbac.User})
+	}
+	for _, name := range r.groups {
+		ret = append(ret, rbac.Subject{Name: name, Kind: rbac.Group})
+	}
+	for _, name := range r.sas {
+		ret = append(ret, rbac.Subject{Name: name, Kind: rbac.ServiceAccount})
+	}
+	return append(ret, r.subjects...)
+}
+
+// request parses the verb and resource arguments. The resource has the form
+// `resource[.group]` like `deployments.apps`, arguments starting with `/` are
+// non-resource URLs.
+func (r *requestFlags) request(args []string) (rbac.Request, error) {
+	if len(args) != 2 {
+		return rbac.Request{}, errUsage
+	}
+
+	req := rbac.Request{Verb: args[0], Subjects: r.requestSubjects()}
+	if len(r.extra) > 0 {
+		req.Extra = r.extra
+	}
+	if strings.HasPrefix(args[1], "/") {
+		req.Path = args[1]
+		return req, nil
+	}
+
+	res, err := rbactest.ParseResource(args[1])
+	if err != nil {
+		return rbac.Request{}, err
+	}
+	res.Namespace, res.ResourceName, res.Subresource = r.namespace, r.name, r.subresource
+	if len(r.attributes) > 0 {
+		res.Attributes = r.attributes
+	}
+	req.Resource = res
+	return req, nil
+}
+
+func validate(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var p policyFlags
+	p.register(fs)
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+	if len(args) != 0 {
+		return 2, errUsage
+	}
+
+	policy, err := p.read()
+	if err == nil {
+		err = rbac.New().SetPolicy(policy)
+	}
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1, nil
+	}
+
+	roles := map[string]bool{}
+	for _, r := range policy.Roles {
+		roles[r.Name] = true
+	}
+	for _, rb := range policy.RoleBindings {
+		if !roles[rb.Role] {
+			fmt.Fprintf(w, "warning: RoleBinding %q refers to the unknown Role %q\n", rb.Name, rb.Role)
+		}
+	}
+
+	fmt.Fprintf(w, "%d roles, %d rolebindings, %d namespaces\n", len(policy.Roles), len(policy.RoleBindings), len(policy.Namespaces))
+	return 0, nil
+}
+
+func canI(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var r requestFlags
+	r.register(fs, true)
+	verbose := fs.Bool("v", false, "print the evaluation result")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+
+	req, err := r.request(args)
+	if err != nil {
+		return 2, err
+	}
+	a, err := r.authorizer()
+	if err != nil {
+		return 2, err
+	}
+
+	res, err := a.EvalContext(context.Background(), req)
+	if err != nil {
+		return 2, err
+	}
+	if *verbose {
+		fmt.Fprintln(w, res)
+	}
+	if !res.Success {
+		fmt.Fprintln(w, "no")
+		return 1, nil
+	}
+	fmt.Fprintln(w, "yes")
+	return 0, nil
+}
+
+func explain(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var r requestFlags
+	r.register(fs, true)
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+
+	req, err := r.request(args)
+	if err != nil {
+		return 2, err
+	}
+	a, err := r.authorizer()
+	if err != nil {
+		return 2, err
+	}
+
+	fmt.Fprint(w, a.Explain(req))
+	return 0, nil
+}
+
+func whoCan(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var r requestFlags
+	r.register(fs, false)
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+
+	req, err := r.request(args)
+	if err != nil {
+		return 2, err
+	}
+	a, err := r.authorizer()
+	if err != nil {
+		return 2, err
+	}
+
+	var permissions []rbac.Permission
+	if req.Path != "" {
+		permissions = a.WhoCanNonResource(req.Verb, req.Path)
+	} else {
+		permissions = a.WhoCan(req.Verb, req.Resource)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBJECT\tROLEBINDING\tROLE\tCONDITION")
+	for _, p := range permissions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Subject, p.RoleBinding, p.Role, p.Condition)
+	}
+	return 0, tw.Flush()
+}
+
+func listRules(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var r requestFlags
+	r.register(fs, true)
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+
+	subjects := r.requestSubjects()
+	if len(args) != 0 || len(subjects) == 0 {
+		return 2, errUsage
+	}
+	a, err := r.authorizer()
+	if err != nil {
+		return 2, err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLEBINDING\tROLE\tNAMESPACE\tVERBS\tAPIGROUPS\tRESOURCES\tRESOURCENAMES\tNONRESOURCEURLS\tCONDITION")
+	for _, g := range a.RulesFor(subjects, r.namespace) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", g.RoleBinding, g.Role, g.Namespace,
+			list(g.Rule.Verbs), list(g.Rule.APIGroups), list(g.Rule.Resources), list(g.Rule.ResourceNames),
+			list(g.Rule.NonResourceURLs), g.Rule.Condition)
+	}
+	return 0, tw.Flush()
+}
+
+// list formats a list of a rule as table cell
+func list(l []string) string {
+	if len(l) == 0 {
+		return "-"
+	}
+	return strings.Join(l, ",")
+}
+
+func diff(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	output := fs.String("o", "text", "output `format`, text or json")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+	if len(args) != 2 || *output != "text" && *output != "json" {
+		return 2, errUsage
+	}
+
+	old, err := rbac.ReadPolicy(args[0])
+	if err != nil {
+		return 2, err
+	}
+	new, err := rbac.ReadPolicy(args[1])
+	if err != nil {
+		return 2, err
+	}
+
+	d, err := rbac.Diff(old, new)
+	if err != nil {
+		return 2, err
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			return 2, err
+		}
+	} else {
+		fmt.Fprint(w, d)
+	}
+
+	if d.Empty() {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func matrix(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var p policyFlags
+	p.register(fs)
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+	if len(args) != 0 {
+		return 2, errUsage
+	}
+
+	policy, err := p.read()
+	if err != nil {
+		return 2, err
+	}
+	return 0, rbac.WritePermissionMatrix(w, policy)
+}
+
+func format(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	write := fs.Bool("w", false, "write the result to the files instead of stdout")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+	if len(args) == 0 {
+		return 2, errUsage
+	}
+
+	for i, file := range args {
+		b, err := formatFile(file)
+		if err != nil {
+			return 2, err
+		}
+
+		if *write {
+			if err := os.WriteFile(file, b, 0644); err != nil {
+				return 2, err
+			}
+			continue
+		}
+
+		if i > 0 && !isJSON(file) {
+			fmt.Fprintln(w, "---")
+		}
+		w.Write(b)
+	}
+	return 0, nil
+}
+
+// formatFile returns the objects of a policy file sorted by name and encoded
+// in the format of the file
+func formatFile(file string) ([]byte, error) {
+	p, err := rbac.ReadPolicyFiles(file)
+	if err != nil {
+		return nil, err
+	}
+
+	a := rbac.New()
+	if err := a.SetPolicy(p); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	var b bytes.Buffer
+	if isJSON(file) {
+		err = a.ExportJSON(&b)
+	} else {
+		err = a.WriteYAML(&b)
+	}
+	return b.Bytes(), err
+}
+
+func isJSON(file string) bool {
+	return strings.ToLower(filepath.Ext(file)) == ".json"
+}
+
+func test(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var p policyFlags
+	p.register(fs)
+	verbose := fs.Bool("v", false, "print passing test cases too")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+	if len(args) == 0 {
+		return 2, errUsage
+	}
+
+	cases, err := rbactest.ReadFiles(args...)
+	if err != nil {
+		return 2, err
+	}
+	a, err := p.authorizer()
+	if err != nil {
+		return 2, err
+	}
+
+	var failed int
+	for _, c := range cases {
+		if err := c.Check(a); err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %s\n%s\n", c.Source, c, err)
+		} else if *verbose {
+			fmt.Fprintf(w, "ok   %s: %s\n", c.Source, c)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL %d of %d test cases\n", failed, len(cases))
+		return 1, nil
+	}
+	fmt.Fprintf(w, "ok   %d test cases\n", len(cases))
+	return 0, nil
+}
+
+func check(fs *flag.FlagSet, args []string, w io.Writer) (int, error) {
+	var p policyFlags
+	p.register(fs)
+	output := fs.String("o", "text", "output `format`, text or json")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return 2, err
+	}
+	if len(args) == 0 || *output != "text" && *output != "json" {
+		return 2, errUsage
+	}
+
+	// Invariant files contain a YAML sequence of invariants
+	var invariants []rbac.Invariant
+	for _, file := range args {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return 2, err
+		}
+
+		var inv []rbac.Invariant
+		if err := yaml.Unmarshal(data, &inv); err != nil {
+			return 2, fmt.Errorf("%s: %w", file, err)
+		}
+		invariants = append(invariants, inv...)
+	}
+
+	policy, err := p.read()
+	if err != nil {
+		return 2, err
+	}
+	violations, err := rbac.CheckInvariants(policy, invariants...)
+	if err != nil {
+		return 2, err
+	}
+
+	if *output == "json" {
+		if violations == nil {
+			violations = []rbac.Violation{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(violations); err != nil {
+			return 2, err
+		}
+	} else {
+		for _, v := range violations {
+			fmt.Fprintln(w, v)
+		}
+		if len(violations) == 0 {
+			fmt.Fprintf(w, "ok   %d invariants hold\n", len(invariants))
+		}
+	}
+
+	if len(violations) > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/djboris9/rbac"
+)
+
+var (
+	examplePolicy = filepath.Join("..", "..", "example.yaml")
+	exampleTests  = filepath.Join("..", "..", "rbactest", "testdata", "example.yaml")
+)
+
+// readonlyPolicy is example.yaml without the readonly Role and RoleBinding
+const readonlyPolicy = `kind: Role
+metadata:
+  name: node-watcher
+rules:
+- verbs: ["get", "list", "watch"]
+  resources: ["nodes", "locations"]
+- verbs: ["get", "update", "delete"]
+  resources: ["nodes/states"]
+  resourceNames: ["linux"]
+---
+kind: RoleBinding
+metadata:
+  name: linux-node-watchers
+  namespace: linux
+roleRef:
+  name: node-watcher
+subjects:
+- kind: User
+  name: bofh
+- kind: ServiceAccount
+  name: integrator
+- kind: Group
+  name: system:core
+---
+kind: RoleBinding
+metadata:
+  name: global-node-watchers
+roleRef:
+  name: node-watcher
+subjects:
+- kind: Group
+  name: superusers
+`
+
+// writeFile writes data to a file in a temporary directory and returns its
+// path
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCommand runs rbacctl with args and returns the exit status and output
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// TestCommands tests the output and exit status of the subcommands
+func TestCommands(t *testing.T) {
+	older := writeFile(t, "old.yaml", readonlyPolicy)
+	invariants := writeFile(t, "invariants.yaml", "- name: no-deletes\n  match:\n    verbs: [delete]\n")
+	holding := writeFile(t, "holding.yaml", "- name: no-secrets\n  match:\n    resources: [secrets]\n")
+	failing := writeFile(t, "failing.yaml", "- as: {user: bofh}\n  verb: delete\n  resource: nodes\n  namespace: linux\n  expect: allow\n")
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout []string // expected lines or substrings of stdout
+		stderr string   // expected substring of stderr
+	}{
+		{[]string{"validate", "-f", examplePolicy}, 0, []string{"2 roles, 3 rolebindings, 0 namespaces\n"}, ""},
+		{[]string{"validate", "-f", exampleTests}, 1, nil, ""},
+		{[]string{"validate", "-f", examplePolicy, "extra"}, 2, nil, "Usage: rbacctl validate"},
+
+		// Flags after the arguments, as well as before and in between
+		{[]string{"can-i", "get", "nodes", "--as", "bofh", "-n", "linux", "-f", examplePolicy}, 0, []string{"yes\n"}, ""},
+		{[]string{"can-i", "-f", examplePolicy, "--as", "bofh", "-n", "linux", "get", "nodes"}, 0, []string{"yes\n"}, ""},
+		{[]string{"can-i", "get", "-n", "linux", "nodes", "--as", "bofh", "-f", examplePolicy}, 0, []string{"yes\n"}, ""},
+		{[]string{"can-i", "delete", "nodes", "--as", "bofh", "-n", "linux", "-f", examplePolicy}, 1, []string{"no\n"}, ""},
+		{[]string{"can-i", "update", "nodes", "--sa", "integrator", "-n", "linux", "--name", "linux", "--subresource", "states", "-f", examplePolicy}, 0, []string{"yes\n"}, ""},
+		{[]string{"can-i", "watch", "locations", "--subject", "Group:superusers", "-v", "-f", examplePolicy}, 0, []string{"global-node-watchers", "yes\n"}, ""},
+		{[]string{"can-i", "get", "/healthz", "--group", "system:core", "-f", examplePolicy}, 1, []string{"no\n"}, ""},
+		{[]string{"can-i", "get", "--", "-nodes", "--as", "bofh", "-f", examplePolicy}, 2, nil, "Usage: rbacctl can-i"},
+		{[]string{"can-i", "get", "nodes", "--bogus", "-f", examplePolicy}, 2, nil, "flag provided but not defined: -bogus"},
+		{[]string{"can-i", "get", "nodes", "-h"}, 0, nil, "Usage: rbacctl can-i"},
+		{[]string{"can-i", "get", "nodes/states", "--as", "bofh", "-f", examplePolicy}, 2, nil, "rbacctl can-i:"},
+		{[]string{"can-i", "get", "--as", "bofh", "-f", examplePolicy}, 2, nil, "Usage: rbacctl can-i"},
+
+		{[]string{"explain", "get", "nodes", "--as", "bofh", "-n", "linux", "-f", examplePolicy}, 0, []string{
+			`authorization succeeded for User "bofh" as node-watcher using linux-node-watchers`,
+			"  + linux-node-watchers (role node-watcher): rule 0 grants to User:bofh\n",
+			"  - readonly-services (role readonly): no subject matches\n",
+		}, ""},
+
+		{[]string{"who-can", "get", "nodes", "-n", "linux", "-f", examplePolicy}, 0, []string{
+			"SUBJECT                    ROLEBINDING           ROLE          CONDITION\n",
+			"User:bofh                  linux-node-watchers   node-watcher  \n",
+			"ServiceAccount:auditor     readonly-services     readonly      \n",
+		}, ""},
+		{[]string{"who-can", "delete", "nodes", "-n", "linux", "-f", examplePolicy}, 0, []string{"SUBJECT"}, ""},
+
+		{[]string{"list-rules", "--as", "bofh", "-n", "linux", "-f", examplePolicy}, 0, []string{
+			"linux-node-watchers  node-watcher  linux      get,list,watch     -          nodes,locations  -              -",
+			"linux-node-watchers  node-watcher  linux      get,update,delete  -          nodes/states     linux          -",
+		}, ""},
+		{[]string{"list-rules", "-n", "linux", "-f", examplePolicy}, 2, nil, "Usage: rbacctl list-rules"},
+
+		{[]string{"diff", examplePolicy, examplePolicy}, 0, nil, ""},
+		{[]string{"diff", older, examplePolicy}, 1, []string{
+			"+ Role readonly\n",
+			"+ RoleBinding readonly-services\n",
+			`+ ServiceAccount:auditor get "linux":"nodes":"" (readonly-services)`,
+		}, ""},
+		{[]string{"diff", examplePolicy, older, "-o", "json"}, 1, []string{`"change": "removed"`}, ""},
+		{[]string{"diff", "-o", "yaml", older, examplePolicy}, 2, nil, "Usage: rbacctl diff"},
+
+		{[]string{"matrix", "-f", examplePolicy}, 0, []string{
+			"# subject namespace resource resourceName verb -> roleBinding [if condition]\n",
+			"User:bofh linux nodes/states linux delete -> linux-node-watchers\n",
+		}, ""},
+
+		{[]string{"fmt", examplePolicy}, 0, []string{"kind: Role\nmetadata:\n  name: node-watcher\n"}, ""},
+		{[]string{"fmt"}, 2, nil, "Usage: rbacctl fmt"},
+
+		{[]string{"check", invariants, "-f", examplePolicy}, 1, []string{
+			`no-deletes: User:bofh delete "linux":"nodes/states":"linux" (linux-node-watchers)`,
+		}, ""},
+		{[]string{"check", "-f", examplePolicy, holding}, 0, []string{"ok   1 invariants hold\n"}, ""},
+		{[]string{"check", "-f", examplePolicy, "-o", "json", holding}, 0, []string{"[]\n"}, ""},
+
+		{[]string{"test", exampleTests, "-f", examplePolicy}, 0, []string{"ok   6 test cases\n"}, ""},
+		{[]string{"test", "-f", examplePolicy, failing}, 1, []string{"FAIL", "expected allow, got deny", "FAIL 1 of 1 test cases\n"}, ""},
+
+		{[]string{"bogus"}, 2, nil, `unknown command "bogus"`},
+		{nil, 2, nil, "Usage: rbacctl <command>"},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCommand(tt.args...)
+		if code != tt.code {
+			t.Errorf("rbacctl %s exited with %d instead of %d\nstdout:\n%s\nstderr:\n%s", strings.Join(tt.args, " "), code, tt.code, stdout, stderr)
+			continue
+		}
+		for _, s := range tt.stdout {
+			if !strings.Contains(stdout, s) {
+				t.Errorf("rbacctl %s: stdout doesn't contain %q:\n%s", strings.Join(tt.args, " "), s, stdout)
+			}
+		}
+		if !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("rbacctl %s: stderr doesn't contain %q:\n%s", strings.Join(tt.args, " "), tt.stderr, stderr)
+		}
+	}
+}
+
+// TestMatrixGolden tests that the matrix of example.yaml matches
+// example_permissions.list
+func TestMatrixGolden(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("..", "..", "example_permissions.list"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCommand("matrix", "-f", examplePolicy)
+	if code != 0 || stdout != string(want) {
+		t.Errorf("Unexpected matrix with exit status %d:\n%s\n%s", code, stdout, stderr)
+	}
+}
+
+// TestFormat tests that fmt keeps the policy and is idempotent, in place and
+// for JSON files
+func TestFormat(t *testing.T) {
+	a := rbac.New()
+	if err := a.LoadDir(examplePolicy); err != nil {
+		t.Fatal(err)
+	}
+	var data bytes.Buffer
+	if err := a.ExportJSON(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"policy.yaml", "policy.json"} {
+		file := writeFile(t, name, readonlyPolicy)
+		if name == "policy.json" {
+			file = writeFile(t, name, data.String())
+		}
+
+		code, formatted, stderr := runCommand("fmt", file)
+		if code != 0 {
+			t.Fatalf("fmt %s exited with %d: %s", name, code, stderr)
+		}
+		if code, _, stderr := runCommand("fmt", "-w", file); code != 0 {
+			t.Fatalf("fmt -w %s exited with %d: %s", name, code, stderr)
+		}
+		written, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != formatted {
+			t.Errorf("fmt -w %s wrote:\n%s\ninstead of:\n%s", name, written, formatted)
+		}
+		if _, again, _ := runCommand("fmt", file); again != formatted {
+			t.Errorf("fmt %s isn't idempotent:\n%s\ninstead of:\n%s", name, again, formatted)
+		}
+		if code, _, stderr := runCommand("validate", "-f", file); code != 0 {
+			t.Errorf("Formatted %s is invalid: %s", name, stderr)
+		}
+	}
+}
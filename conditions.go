@@ -0,0 +1,635 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// condition is a compiled rule condition. Conditions are written in a small
+// expression language that is evaluated in-process and has no side effects:
+//
+//	attr.owner == subject.name
+//	hour() >= 9 && hour() < 17 && weekday() in [1, 2, 3, 4, 5]
+//	cidr(attr.ip, "10.0.0.0/8") || cidr(attr.ip, "192.168.0.0/16")
+//
+// The following identifiers are available:
+//
+//	verb, namespace, resource, name   the requested verb and resource
+//	apiGroup, subresource             the requested API group and subresource
+//	path                              the requested non-resource URL
+//	subject.name, subject.kind        the subject that matched the RoleBinding
+//	attr.<key>                        a resource attribute, "" if missing
+//	extra.<key>                       a request attribute, "" if missing
+//
+// The following functions are available:
+//
+//	cidr(ip, network)                 true if ip is part of the CIDR network
+//	startsWith(s, prefix), endsWith(s, suffix)
+//	hour(), weekday()                 the current hour (0-23) and weekday (0 is Sunday)
+//
+// Supported operators are `||`, `&&`, `!`, `==`, `!=`, `<`, `<=`, `>`, `>=`
+// and `in` with a list on the right hand side.
+type condition struct {
+	src  string
+	root condNode
+}
+
+// condEnv provides the values a condition is evaluated against
+type condEnv struct {
+	verb     string
+	subject  Subject
+	resource Resource
+	path     string
+	extra    map[string]string
+	now      time.Time
+}
+
+// condNode represents a node of a parsed condition
+type condNode interface {
+	eval(env *condEnv) (interface{}, error)
+}
+
+// compileCondition parses the condition expression `src`
+func compileCondition(src string) (*condition, error) {
+	p := &condParser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.val, tok.pos)
+	}
+
+	return &condition{src: src, root: root}, nil
+}
+
+// eval evaluates the condition and returns an error if the condition doesn't
+// evaluate to a boolean value
+func (c *condition) eval(env *condEnv) (bool, error) {
+	v, err := c.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluated to %v instead of a boolean", v)
+	}
+	return b, nil
+}
+
+type condTokenKind int
+
+const (
+	tokEOF condTokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type condToken struct {
+	kind condTokenKind
+	val  string
+	pos  int
+}
+
+// condParser is a recursive descent parser for conditions
+type condParser struct {
+	src    string
+	tokens []condToken
+	pos    int
+}
+
+// condOperators lists all operators, longer ones first
+var condOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func (p *condParser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && rune(s[j]) != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated string at position %d", i)
+			}
+			str := s[i+1 : j]
+			if c == '"' {
+				var err error
+				str, err = strconv.Unquote(s[i : j+1])
+				if err != nil {
+					return fmt.Errorf("invalid string at position %d", i)
+				}
+			}
+			p.tokens = append(p.tokens, condToken{tokString, str, i})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, condToken{tokNumber, s[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '-' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, condToken{tokIdent, s[i:j], i})
+			i = j
+		default:
+			var found bool
+			for _, op := range condOperators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, condToken{tokOp, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, condToken{tokEOF, "end of condition", len(s)})
+	return nil
+}
+
+func (p *condParser) peek() condToken {
+	return p.tokens[p.pos]
+}
+
+func (p *condParser) next() condToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the operator or keyword `val`
+func (p *condParser) accept(val string) bool {
+	tok := p.peek()
+	if (tok.kind == tokOp || tok.kind == tokIdent) && tok.val == val {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *condParser) expect(val string) error {
+	if !p.accept(val) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q but got %q at position %d", val, tok.val, tok.pos)
+	}
+	return nil
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &condLogical{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &condLogical{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseNot() (condNode, error) {
+	if p.accept("!") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &condNot{n}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *condParser) parseCompare() (condNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.kind == tokOp && (tok.val == "==" || tok.val == "!=" || tok.val == "<" ||
+		tok.val == "<=" || tok.val == ">" || tok.val == ">="),
+		tok.kind == tokIdent && tok.val == "in":
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &condCompare{op: tok.val, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *condParser) parsePrimary() (condNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return condLiteral{tok.val}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.val, tok.pos)
+		}
+		return condLiteral{f}, nil
+	case tokIdent:
+		switch tok.val {
+		case "true":
+			return condLiteral{true}, nil
+		case "false":
+			return condLiteral{false}, nil
+		}
+
+		if p.accept("(") {
+			return p.parseCall(tok)
+		}
+
+		path := []string{tok.val}
+		for p.accept(".") {
+			field := p.next()
+			if field.kind != tokIdent {
+				return nil, fmt.Errorf("expected identifier but got %q at position %d", field.val, field.pos)
+			}
+			path = append(path, field.val)
+		}
+		return newCondIdent(path, tok.pos)
+	case tokOp:
+		switch tok.val {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			list := condList{}
+			for !p.accept("]") {
+				if len(list) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				n, err := p.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, n)
+			}
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.val, tok.pos)
+}
+
+func (p *condParser) parseCall(name condToken) (condNode, error) {
+	fn, ok := condFuncs[name.val]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.val, name.pos)
+	}
+
+	call := &condCall{name: name.val, fn: fn.fn}
+	for !p.accept(")") {
+		if len(call.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, n)
+	}
+
+	if len(call.args) != fn.args {
+		return nil, fmt.Errorf("function %q expects %d arguments, got %d", name.val, fn.args, len(call.args))
+	}
+	return call, nil
+}
+
+// condLiteral is a constant string, number or boolean
+type condLiteral struct {
+	v interface{}
+}
+
+func (n condLiteral) eval(*condEnv) (interface{}, error) {
+	return n.v, nil
+}
+
+// condList is a list of values, used as right hand side of `in`
+type condList []condNode
+
+func (n condList) eval(env *condEnv) (interface{}, error) {
+	ret := make([]interface{}, 0, len(n))
+	for _, e := range n {
+		v, err := e.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// condIdent resolves an identifier from the evaluation environment
+type condIdent struct {
+	path    string
+	resolve func(env *condEnv) interface{}
+}
+
+func newCondIdent(path []string, pos int) (condNode, error) {
+	var resolve func(env *condEnv) interface{}
+	switch {
+	case len(path) == 1 && path[0] == "verb":
+		resolve = func(env *condEnv) interface{} { return env.verb }
+	case len(path) == 1 && path[0] == "namespace":
+		resolve = func(env *condEnv) interface{} { return env.resource.Namespace }
+	case len(path) == 1 && path[0] == "resource":
+		resolve = func(env *condEnv) interface{} { return env.resource.Resource }
+	case len(path) == 1 && path[0] == "path":
+		resolve = func(env *condEnv) interface{} { return env.path }
+	case len(path) == 1 && path[0] == "apiGroup":
+		resolve = func(env *condEnv) interface{} { return env.resource.APIGroup }
+	case len(path) == 1 && path[0] == "subresource":
+		resolve = func(env *condEnv) interface{} { return env.resource.Subresource }
+	case len(path) == 1 && path[0] == "name":
+		resolve = func(env *condEnv) interface{} { return env.resource.ResourceName }
+	case len(path) == 2 && path[0] == "subject" && path[1] == "name":
+		resolve = func(env *condEnv) interface{} { return env.subject.Name }
+	case len(path) == 2 && path[0] == "subject" && path[1] == "kind":
+		resolve = func(env *condEnv) interface{} { return env.subject.Kind.String() }
+	case len(path) == 2 && path[0] == "attr":
+		key := path[1]
+		resolve = func(env *condEnv) interface{} { return env.resource.Attributes[key] }
+	case len(path) == 2 && path[0] == "extra":
+		key := path[1]
+		resolve = func(env *condEnv) interface{} { return env.extra[key] }
+	default:
+		return nil, fmt.Errorf("unknown identifier %q at position %d", strings.Join(path, "."), pos)
+	}
+	return &condIdent{path: strings.Join(path, "."), resolve: resolve}, nil
+}
+
+func (n *condIdent) eval(env *condEnv) (interface{}, error) {
+	return n.resolve(env), nil
+}
+
+// condNot negates a boolean value
+type condNot struct {
+	n condNode
+}
+
+func (n *condNot) eval(env *condEnv) (interface{}, error) {
+	b, err := condBool(n.n, env, "!")
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+// condLogical implements the short circuiting operators `&&` and `||`
+type condLogical struct {
+	op          string
+	left, right condNode
+}
+
+func (n *condLogical) eval(env *condEnv) (interface{}, error) {
+	l, err := condBool(n.left, env, n.op)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !l || n.op == "||" && l {
+		return l, nil
+	}
+	return condBool(n.right, env, n.op)
+}
+
+// condBool evaluates `n` and ensures the result is a boolean operand of `op`
+func condBool(n condNode, env *condEnv, op string) (bool, error) {
+	v, err := n.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("operator %s expects booleans, got %v", op, v)
+	}
+	return b, nil
+}
+
+// condCompare implements the comparison operators and `in`
+type condCompare struct {
+	op          string
+	left, right condNode
+}
+
+func (n *condCompare) eval(env *condEnv) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "in" {
+		list, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operator in expects a list, got %v", r)
+		}
+		for _, e := range list {
+			if c, err := condCompareValues(l, e); err == nil && c == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	c, err := condCompareValues(l, r)
+	if err != nil {
+		if n.op == "==" || n.op == "!=" {
+			// Values of different types are never equal
+			return n.op == "!=", nil
+		}
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// condCompareValues compares two values and returns -1, 0 or 1. Strings are
+// converted to numbers if compared to a number.
+func condCompareValues(l, r interface{}) (int, error) {
+	if ls, ok := l.(string); ok {
+		if _, ok := r.(float64); ok {
+			f, err := strconv.ParseFloat(ls, 64)
+			if err != nil {
+				return 0, fmt.Errorf("cannot compare %q to a number", ls)
+			}
+			l = f
+		}
+	}
+	if rs, ok := r.(string); ok {
+		if _, ok := l.(float64); ok {
+			f, err := strconv.ParseFloat(rs, 64)
+			if err != nil {
+				return 0, fmt.Errorf("cannot compare %q to a number", rs)
+			}
+			r = f
+		}
+	}
+
+	switch lv := l.(type) {
+	case string:
+		if rv, ok := r.(string); ok {
+			return strings.Compare(lv, rv), nil
+		}
+	case float64:
+		if rv, ok := r.(float64); ok {
+			switch {
+			case lv < rv:
+				return -1, nil
+			case lv > rv:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case bool:
+		if rv, ok := r.(bool); ok {
+			if lv == rv {
+				return 0, nil
+			}
+			return 1, errors.New("booleans can only be compared for equality")
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %v to %v", l, r)
+}
+
+// condFunc is a builtin function callable from conditions
+type condFunc struct {
+	args int
+	fn   func(env *condEnv, args []interface{}) (interface{}, error)
+}
+
+var condFuncs = map[string]condFunc{
+	"cidr": {2, func(env *condEnv, args []interface{}) (interface{}, error) {
+		ip, network, err := condStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		_, ipnet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, err
+		}
+		parsed := net.ParseIP(ip)
+		return parsed != nil && ipnet.Contains(parsed), nil
+	}},
+	"startsWith": {2, func(env *condEnv, args []interface{}) (interface{}, error) {
+		s, prefix, err := condStrings(args)
+		return strings.HasPrefix(s, prefix), err
+	}},
+	"endsWith": {2, func(env *condEnv, args []interface{}) (interface{}, error) {
+		s, suffix, err := condStrings(args)
+		return strings.HasSuffix(s, suffix), err
+	}},
+	"hour": {0, func(env *condEnv, args []interface{}) (interface{}, error) {
+		return float64(env.now.Hour()), nil
+	}},
+	"weekday": {0, func(env *condEnv, args []interface{}) (interface{}, error) {
+		return float64(env.now.Weekday()), nil
+	}},
+}
+
+// condStrings returns both arguments of a function call as strings
+func condStrings(args []interface{}) (string, string, error) {
+	a, ok := args[0].(string)
+	b, ok2 := args[1].(string)
+	if !ok || !ok2 {
+		return "", "", fmt.Errorf("expected string arguments, got %v and %v", args[0], args[1])
+	}
+	return a, b, nil
+}
+
+// condCall is a call of a builtin function
+type condCall struct {
+	name string
+	fn   func(env *condEnv, args []interface{}) (interface{}, error)
+	args []condNode
+}
+
+func (n *condCall) eval(env *condEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	v, err := n.fn(env, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %s", n.name, err)
+	}
+	return v, nil
+}
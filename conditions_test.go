@@ -0,0 +1,195 @@
+package rbac
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCompileCondition tests the parsing of valid and invalid conditions
+func TestCompileCondition(t *testing.T) {
+	valid := []string{
+		`attr.owner == subject.name`,
+		`hour() >= 9 && hour() < 17 && weekday() in [1, 2, 3, 4, 5]`,
+		`cidr(attr.ip, "10.0.0.0/8") || !(verb != 'get')`,
+		`startsWith(name, "tmp-") && endsWith(namespace, "-dev")`,
+		`true`,
+	}
+	for _, src := range valid {
+		if _, err := compileCondition(src); err != nil {
+			t.Errorf("Condition %q should compile, got %q", src, err)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`attr.owner ==`,
+		`unknown == "x"`,
+		`attr.owner == "x`,
+		`nofunc()`,
+		`cidr(attr.ip)`,
+		`(true`,
+		`[1, 2`,
+		`true true`,
+		`verb # "get"`,
+	}
+	for _, src := range invalid {
+		if _, err := compileCondition(src); err == nil {
+			t.Errorf("Condition %q should not compile", src)
+		}
+	}
+}
+
+// TestEvalCondition tests the evaluation of conditions against an environment
+func TestEvalCondition(t *testing.T) {
+	env := &condEnv{
+		verb:    "update",
+		subject: Subject{Name: "bofh", Kind: User},
+		resource: Resource{
+			Namespace:    "linux",
+			Resource:     "documents",
+			ResourceName: "tmp-1",
+			Attributes:   map[string]string{"owner": "bofh", "ip": "10.1.2.3", "size": "42"},
+		},
+		now: time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC), // Wednesday
+	}
+
+	tests := map[string]bool{
+		`attr.owner == subject.name`:                                 true,
+		`attr.owner != subject.name`:                                 false,
+		`attr.missing == ""`:                                         true,
+		`subject.kind == "User" && verb in ["update", "delete"]`:     true,
+		`cidr(attr.ip, "10.0.0.0/8")`:                                true,
+		`cidr(attr.ip, "192.168.0.0/16")`:                            false,
+		`hour() >= 9 && hour() < 17 && weekday() in [1, 2, 3, 4, 5]`: true,
+		`weekday() == 0 || weekday() == 6`:                           false,
+		`attr.size > 40 && attr.size <= 42`:                          true,
+		`startsWith(name, "tmp-") && !endsWith(namespace, "y")`:      true,
+		`resource == "documents" && namespace == "linux"`:            true,
+		`false || true && false`:                                     false,
+	}
+	for src, expected := range tests {
+		cond, err := compileCondition(src)
+		if err != nil {
+			t.Fatalf("Condition %q should compile, got %q", src, err)
+		}
+		res, err := cond.eval(env)
+		if err != nil {
+			t.Fatalf("Condition %q failed with %q", src, err)
+		}
+		if res != expected {
+			t.Errorf("Condition %q evaluated to %t, expected %t", src, res, expected)
+		}
+	}
+
+	for _, src := range []string{`attr.owner`, `attr.owner > 3`, `!attr.owner`, `cidr(attr.ip, "x")`} {
+		cond, err := compileCondition(src)
+		if err != nil {
+			t.Fatalf("Condition %q should compile, got %q", src, err)
+		}
+		if _, err := cond.eval(env); err == nil {
+			t.Errorf("Condition %q should fail to evaluate", src)
+		}
+	}
+}
+
+// TestRBACConditions tests the evaluation of rules with conditions
+func TestRBACConditions(t *testing.T) {
+	a := New()
+	a.SetClock(func() time.Time { return time.Date(2020, 3, 4, 20, 0, 0, 0, time.UTC) })
+
+	if err := a.SetRole(Role{Name: "broken", Rules: []Rule{{
+		Verbs:     []string{"get"},
+		Resources: []string{"documents"},
+		Condition: "attr.owner ==",
+	}}}); err == nil {
+		t.Fatal("SetRole should fail for an invalid condition")
+	}
+
+	err := a.SetRole(Role{Name: "owner", Rules: []Rule{{
+		Verbs:     []string{"update"},
+		Resources: []string{"documents"},
+		Condition: "attr.owner == subject.name",
+	}, {
+		Verbs:     []string{"delete"},
+		Resources: []string{"documents"},
+		Condition: "hour() >= 9 && hour() < 17",
+	}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "owners", Role: "owner", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	subject := []Subject{{Name: "bofh", Kind: User}}
+	res := a.Eval("update", subject, Resource{Resource: "documents", Attributes: map[string]string{"owner": "bofh"}})
+	if !res.Success {
+		t.Fatalf("Should validate, but didn't: %s", res)
+	}
+
+	res = a.Eval("update", subject, Resource{Resource: "documents", Attributes: map[string]string{"owner": "alice"}})
+	if res.Success || len(res.ConditionFailures) != 1 {
+		t.Fatalf("Should not validate because of the condition: %s", res)
+	}
+	if !strings.Contains(res.String(), "not satisfied") {
+		t.Errorf("Result should explain the condition failure: %s", res)
+	}
+
+	res = a.Eval("delete", subject, Resource{Resource: "documents"})
+	if res.Success || len(res.ConditionFailures) != 1 {
+		t.Fatalf("Should not validate outside business hours: %s", res)
+	}
+
+	a.SetClock(func() time.Time { return time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC) })
+	res = a.Eval("delete", subject, Resource{Resource: "documents"})
+	if !res.Success {
+		t.Fatalf("Should validate during business hours, but didn't: %s", res)
+	}
+}
+
+// TestRBACConditionsSubjects tests that a condition is satisfied if it holds
+// for any of the requesting subjects the RoleBinding matches, independent of
+// their order
+func TestRBACConditionsSubjects(t *testing.T) {
+	a := New()
+	err := a.SetRole(Role{Name: "owner", Rules: []Rule{{
+		Verbs:     []string{"update"},
+		Resources: []string{"documents"},
+		Condition: "attr.owner == subject.name",
+	}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "owners", Role: "owner", Subjects: []Subject{
+		{Name: "bofh", Kind: User},
+		{Name: "admins", Kind: Group},
+	}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	bofh, admins := Subject{Name: "bofh", Kind: User}, Subject{Name: "admins", Kind: Group}
+	for _, subjects := range [][]Subject{{bofh, admins}, {admins, bofh}} {
+		for _, owner := range []Subject{bofh, admins} {
+			res := a.Eval("update", subjects, Resource{Resource: "documents", Attributes: map[string]string{"owner": owner.Name}})
+			if !res.Success {
+				t.Fatalf("Should validate for %v owned by %s, but didn't: %s", subjects, owner, res)
+			}
+			if res.Subject != owner.Name || res.SubjectType != owner.Kind {
+				t.Errorf("Should be attributed to %s for %v: %s", owner, subjects, res)
+			}
+			if res2 := a.For(subjects).CheckRequest(res.Request); !reflect.DeepEqual(res, res2) {
+				t.Errorf("Checker returned a different result:\n%s\n%s", res, res2)
+			}
+		}
+
+		res := a.Eval("update", subjects, Resource{Resource: "documents", Attributes: map[string]string{"owner": "alice"}})
+		if res.Success || len(res.ConditionFailures) != 2 {
+			t.Errorf("Should not validate and report the condition for both subjects: %s", res)
+		}
+	}
+}
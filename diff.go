@@ -0,0 +1,145 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeType represents how an object differs between two policies
+type ChangeType string
+
+// The ChangeTypes of an ObjectChange
+const (
+	Added    ChangeType = "added"
+	Removed  ChangeType = "removed"
+	Modified ChangeType = "modified"
+)
+
+// ObjectChange represents a Role, RoleBinding or Namespace that differs
+// between two policies
+type ObjectChange struct {
+	Kind   string     `json:"kind"`
+	Name   string     `json:"name"`
+	Change ChangeType `json:"change"`
+}
+
+// PolicyDiff represents the differences between two policies. Objects lists
+// the changed objects ordered by kind and name. Added and Removed list the
+// effective permissions that the new policy grants and no longer grants, see
+// EffectivePermissions. A permission whose RoleBinding changed but that is
+// still granted isn't listed. PolicyDiff can be encoded as JSON.
+type PolicyDiff struct {
+	Objects []ObjectChange `json:"objects"`
+	Added   []Permission   `json:"added"`
+	Removed []Permission   `json:"removed"`
+}
+
+// Diff compares two policies. The effective permissions are enumerated over
+// the Domain of both policies. It fails if one of the policies is invalid.
+func Diff(old, new Policy) (PolicyDiff, error) {
+	d := PolicyDiff{Objects: []ObjectChange{}, Added: []Permission{}, Removed: []Permission{}}
+
+	oldObjects, newObjects := old.documents(), new.documents()
+	for key, doc := range oldObjects {
+		kind, name := splitDocumentKey(key)
+		if newDoc, ok := newObjects[key]; !ok {
+			d.Objects = append(d.Objects, ObjectChange{Kind: kind, Name: name, Change: Removed})
+		} else if newDoc != doc {
+			d.Objects = append(d.Objects, ObjectChange{Kind: kind, Name: name, Change: Modified})
+		}
+	}
+	for key := range newObjects {
+		if _, ok := oldObjects[key]; !ok {
+			kind, name := splitDocumentKey(key)
+			d.Objects = append(d.Objects, ObjectChange{Kind: kind, Name: name, Change: Added})
+		}
+	}
+	sort.Slice(d.Objects, func(i, j int) bool {
+		if d.Objects[i].Kind != d.Objects[j].Kind {
+			return d.Objects[i].Kind < d.Objects[j].Kind
+		}
+		return d.Objects[i].Name < d.Objects[j].Name
+	})
+
+	domain := PolicyDomain(old, new)
+	oldPermissions, err := EffectivePermissions(old, domain)
+	if err != nil {
+		return d, fmt.Errorf("old policy: %w", err)
+	}
+	newPermissions, err := EffectivePermissions(new, domain)
+	if err != nil {
+		return d, fmt.Errorf("new policy: %w", err)
+	}
+
+	granted := map[string]bool{}
+	for _, p := range oldPermissions {
+		granted[p.key()] = true
+	}
+	for _, p := range newPermissions {
+		if !granted[p.key()] {
+			d.Added = append(d.Added, p)
+		}
+		delete(granted, p.key())
+	}
+	for _, p := range oldPermissions {
+		if granted[p.key()] {
+			d.Removed = append(d.Removed, p)
+		}
+	}
+	return d, nil
+}
+
+// documents returns the JSON encoding of the objects of the policy by kind and
+// name, so they can be compared regardless of nil and empty slices
+func (p Policy) documents() map[string]string {
+	ret := map[string]string{}
+	for _, item := range p.items() {
+		b, _ := json.Marshal(item)
+		var key string
+		switch o := item.(type) {
+		case Role:
+			key = kindRole + "/" + o.Name
+		case RoleBinding:
+			key = kindRoleBinding + "/" + o.Name
+		case Namespace:
+			key = kindNamespace + "/" + o.Name
+		}
+		ret[key] = string(b)
+	}
+	return ret
+}
+
+// splitDocumentKey splits a key of Policy.documents into kind and name
+func splitDocumentKey(key string) (string, string) {
+	i := strings.IndexByte(key, '/')
+	return key[:i], key[i+1:]
+}
+
+// Empty returns true if the policies don't differ
+func (d PolicyDiff) Empty() bool {
+	return len(d.Objects) == 0 && len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// String returns the differences as text. Changed objects are prefixed by `+`,
+// `-` or `~` and permissions by `+` or `-`, followed by the granting
+// RoleBinding:
+//
+//	~ Role node-watcher
+//	+ User:bofh delete "linux":"nodes":"" (linux-node-watchers)
+func (d PolicyDiff) String() string {
+	var b strings.Builder
+	for _, o := range d.Objects {
+		prefix := map[ChangeType]string{Added: "+", Removed: "-", Modified: "~"}[o.Change]
+		fmt.Fprintf(&b, "%s %s %s\n", prefix, o.Kind, o.Name)
+	}
+
+	for _, p := range d.Added {
+		fmt.Fprintf(&b, "+ %s (%s)\n", p, p.RoleBinding)
+	}
+	for _, p := range d.Removed {
+		fmt.Fprintf(&b, "- %s (%s)\n", p, p.RoleBinding)
+	}
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package rbac
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDiff tests the object and effective permission differences of policies
+func TestDiff(t *testing.T) {
+	old := createExtensiveAuthorizer().Policy()
+	if d, err := Diff(old, old); err != nil || !d.Empty() {
+		t.Fatalf("Equal policies shouldn't differ, got %s, %v", d, err)
+	}
+
+	a := createExtensiveAuthorizer()
+	err := a.SetRole(Role{Name: "readonly", Rules: []Rule{{
+		Verbs:     []string{"get", "list", "watch"},
+		Resources: []string{"nodes", "locations"},
+	}, {
+		Verbs:     []string{"delete"},
+		Resources: []string{"nodes"},
+		Condition: `attr.owner == subject.name`,
+	}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	a.DeleteRoleBinding("linux-node-watchers")
+	err = a.SetRoleBinding(RoleBinding{Name: "bofh-watches-linux", Role: "node-watcher", Namespace: "linux",
+		Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	d, err := Diff(old, a.Policy())
+	if err != nil {
+		t.Fatalf("Diff failed with %q", err)
+	}
+
+	expected := []ObjectChange{
+		{Kind: "Role", Name: "readonly", Change: Modified},
+		{Kind: "RoleBinding", Name: "bofh-watches-linux", Change: Added},
+		{Kind: "RoleBinding", Name: "linux-node-watchers", Change: Removed},
+	}
+	if !reflect.DeepEqual(d.Objects, expected) {
+		t.Errorf("Unexpected object changes %+v", d.Objects)
+	}
+
+	// The auditor gains the conditional delete for every namespace
+	for _, p := range d.Added {
+		if p.Subject != (Subject{Name: "auditor", Kind: ServiceAccount}) || p.Verb != "delete" || p.Condition == "" {
+			t.Errorf("Unexpected added permission %s", p)
+		}
+	}
+	if len(d.Added) == 0 {
+		t.Error("Conditional delete should be added")
+	}
+
+	// bofh keeps its permissions through the new RoleBinding
+	for _, p := range d.Removed {
+		if p.Subject.Name == "bofh" {
+			t.Errorf("bofh shouldn't lose %s", p)
+		}
+	}
+	if !strings.Contains(d.String(), `- ServiceAccount:integrator get "linux":"nodes":"" (linux-node-watchers)`) {
+		t.Errorf("Integrator should lose its permissions:\n%s", d)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Encoding the diff failed with %q", err)
+	}
+	var decoded PolicyDiff
+	if err := json.Unmarshal(b, &decoded); err != nil || !reflect.DeepEqual(decoded, d) {
+		t.Errorf("Diff should survive JSON encoding, got %v:\n%s", err, b)
+	}
+}
+
+// TestDiffConditionMasking tests that a conditional rule doesn't mask an
+// unconditional rule of the same permission after it
+func TestDiffConditionMasking(t *testing.T) {
+	conditional := Rule{Verbs: []string{"delete"}, Resources: []string{"docs"}, Condition: `attr.owner == subject.name`}
+	unconditional := Rule{Verbs: []string{"delete"}, Resources: []string{"docs"}}
+	policy := func(rules ...Rule) Policy {
+		return Policy{
+			Roles:        []Role{{Name: "editor", Rules: rules}},
+			RoleBindings: []RoleBinding{{Name: "editors", Role: "editor", Subjects: []Subject{{Name: "bofh", Kind: User}}}},
+		}
+	}
+
+	d, err := Diff(policy(conditional, unconditional), policy(conditional))
+	if err != nil {
+		t.Fatalf("Diff failed with %q", err)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Condition != "" || len(d.Added) != 1 || d.Added[0].Condition != conditional.Condition {
+		t.Errorf("Removing the unconditional rule should turn the permission conditional:\n%s", d)
+	}
+
+	d, err = Diff(policy(conditional), policy(conditional, unconditional))
+	if err != nil {
+		t.Fatalf("Diff failed with %q", err)
+	}
+	if len(d.Added) != 1 || d.Added[0].Condition != "" || len(d.Removed) != 1 {
+		t.Errorf("Adding the unconditional rule should make the permission unconditional:\n%s", d)
+	}
+}
@@ -0,0 +1,459 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The kinds of the encoded objects
+const (
+	kindRole        = "Role"
+	kindRoleBinding = "RoleBinding"
+	kindNamespace   = "Namespace"
+	kindList        = "List"
+)
+
+// subjectDocument represents the encoded form of a Subject with its kind as string
+type subjectDocument struct {
+	Kind string `json:"kind" yaml:"kind"`
+	Name string `json:"name" yaml:"name"`
+}
+
+// MarshalJSON encodes the subject as `{"kind": "User", "name": "bofh"}`. It
+// fails for invalid kinds, which couldn't be decoded again.
+func (s Subject) MarshalJSON() ([]byte, error) {
+	doc, err := s.document()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON decodes a subject encoded by MarshalJSON
+func (s *Subject) UnmarshalJSON(b []byte) error {
+	var doc subjectDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	return s.fromDocument(doc)
+}
+
+// MarshalYAML encodes the subject with the fields `kind` and `name`
+func (s Subject) MarshalYAML() (interface{}, error) {
+	return s.document()
+}
+
+// UnmarshalYAML decodes a subject encoded by MarshalYAML
+func (s *Subject) UnmarshalYAML(value *yaml.Node) error {
+	var doc subjectDocument
+	if err := value.Decode(&doc); err != nil {
+		return err
+	}
+	return s.fromDocument(doc)
+}
+
+func (s Subject) document() (subjectDocument, error) {
+	kind, err := s.Kind.MarshalText()
+	if err != nil {
+		return subjectDocument{}, err
+	}
+	return subjectDocument{Kind: string(kind), Name: s.Name}, nil
+}
+
+func (s *Subject) fromDocument(doc subjectDocument) error {
+	kind, err := ParseSubjectKind(doc.Kind)
+	if err != nil {
+		return err
+	}
+
+	s.Kind = kind
+	s.Name = doc.Name
+	return nil
+}
+
+// metadataDocument represents the metadata of an encoded object
+type metadataDocument struct {
+	Name      string            `json:"name" yaml:"name"`
+	Namespace string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// roleDocument represents the encoded form of a Role
+type roleDocument struct {
+	Kind     string           `json:"kind" yaml:"kind"`
+	Metadata metadataDocument `json:"metadata" yaml:"metadata"`
+	Rules    []Rule           `json:"rules" yaml:"rules"`
+}
+
+// roleRefDocument references the Role of an encoded RoleBinding
+type roleRefDocument struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// roleBindingDocument represents the encoded form of a RoleBinding
+type roleBindingDocument struct {
+	Kind              string            `json:"kind" yaml:"kind"`
+	Metadata          metadataDocument  `json:"metadata" yaml:"metadata"`
+	RoleRef           roleRefDocument   `json:"roleRef" yaml:"roleRef"`
+	Namespaces        []string          `json:"namespaces,omitempty" yaml:"namespaces,flow,omitempty"`
+	NamespaceSelector map[string]string `json:"namespaceSelector,omitempty" yaml:"namespaceSelector,omitempty"`
+	Subjects          []Subject         `json:"subjects" yaml:"subjects"`
+	NotBefore         *time.Time        `json:"notBefore,omitempty" yaml:"notBefore,omitempty"`
+	NotAfter          *time.Time        `json:"notAfter,omitempty" yaml:"notAfter,omitempty"`
+	Approvals         []Approval        `json:"approvals,omitempty" yaml:"approvals,omitempty"`
+}
+
+// namespaceDocument represents the encoded form of a Namespace
+type namespaceDocument struct {
+	Kind     string           `json:"kind" yaml:"kind"`
+	Metadata metadataDocument `json:"metadata" yaml:"metadata"`
+}
+
+// kindDocument is used to detect the kind of an encoded object
+type kindDocument struct {
+	Kind string `json:"kind" yaml:"kind"`
+}
+
+// checkKind returns an error if the kind of a decoded object is set and
+// isn't the expected one
+func checkKind(kind, expected string) error {
+	if kind != "" && kind != expected {
+		return fmt.Errorf("expected kind %s, got %q", expected, kind)
+	}
+	return nil
+}
+
+func (r Role) document() roleDocument {
+	// Roles without rules are written with an empty list, so they encode the
+	// same regardless of how they were created
+	rules := r.Rules
+	if rules == nil {
+		rules = []Rule{}
+	}
+	return roleDocument{Kind: kindRole, Metadata: metadataDocument{Name: r.Name}, Rules: rules}
+}
+
+func (r *Role) fromDocument(doc roleDocument) error {
+	if err := checkKind(doc.Kind, kindRole); err != nil {
+		return err
+	}
+
+	*r = Role{Name: doc.Metadata.Name, Rules: doc.Rules}
+	return nil
+}
+
+// MarshalJSON encodes the role in the format of example.yaml
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.document())
+}
+
+// UnmarshalJSON decodes a role encoded by MarshalJSON
+func (r *Role) UnmarshalJSON(b []byte) error {
+	var doc roleDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	return r.fromDocument(doc)
+}
+
+// MarshalYAML encodes the role in the format of example.yaml
+func (r Role) MarshalYAML() (interface{}, error) {
+	return r.document(), nil
+}
+
+// UnmarshalYAML decodes a role encoded by MarshalYAML
+func (r *Role) UnmarshalYAML(value *yaml.Node) error {
+	var doc roleDocument
+	if err := value.Decode(&doc); err != nil {
+		return err
+	}
+	return r.fromDocument(doc)
+}
+
+func (r RoleBinding) document() roleBindingDocument {
+	doc := roleBindingDocument{
+		Kind:              kindRoleBinding,
+		Metadata:          metadataDocument{Name: r.Name, Namespace: r.Namespace},
+		RoleRef:           roleRefDocument{Name: r.Role},
+		Namespaces:        r.Namespaces,
+		NamespaceSelector: r.NamespaceSelector,
+		Subjects:          r.Subjects,
+		Approvals:         r.Approvals,
+	}
+	if !r.NotBefore.IsZero() {
+		doc.NotBefore = &r.NotBefore
+	}
+	if !r.NotAfter.IsZero() {
+		doc.NotAfter = &r.NotAfter
+	}
+	return doc
+}
+
+func (r *RoleBinding) fromDocument(doc roleBindingDocument) error {
+	if err := checkKind(doc.Kind, kindRoleBinding); err != nil {
+		return err
+	}
+
+	*r = RoleBinding{
+		Name:              doc.Metadata.Name,
+		Role:              doc.RoleRef.Name,
+		Namespace:         doc.Metadata.Namespace,
+		Namespaces:        doc.Namespaces,
+		NamespaceSelector: doc.NamespaceSelector,
+		Subjects:          doc.Subjects,
+		Approvals:         doc.Approvals,
+	}
+	if doc.NotBefore != nil {
+		r.NotBefore = *doc.NotBefore
+	}
+	if doc.NotAfter != nil {
+		r.NotAfter = *doc.NotAfter
+	}
+	return nil
+}
+
+// MarshalJSON encodes the role binding in the format of example.yaml
+func (r RoleBinding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.document())
+}
+
+// UnmarshalJSON decodes a role binding encoded by MarshalJSON
+func (r *RoleBinding) UnmarshalJSON(b []byte) error {
+	var doc roleBindingDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	return r.fromDocument(doc)
+}
+
+// MarshalYAML encodes the role binding in the format of example.yaml
+func (r RoleBinding) MarshalYAML() (interface{}, error) {
+	return r.document(), nil
+}
+
+// UnmarshalYAML decodes a role binding encoded by MarshalYAML
+func (r *RoleBinding) UnmarshalYAML(value *yaml.Node) error {
+	var doc roleBindingDocument
+	if err := value.Decode(&doc); err != nil {
+		return err
+	}
+	return r.fromDocument(doc)
+}
+
+func (n Namespace) document() namespaceDocument {
+	return namespaceDocument{Kind: kindNamespace, Metadata: metadataDocument{Name: n.Name, Labels: n.Labels}}
+}
+
+func (n *Namespace) fromDocument(doc namespaceDocument) error {
+	if err := checkKind(doc.Kind, kindNamespace); err != nil {
+		return err
+	}
+
+	*n = Namespace{Name: doc.Metadata.Name, Labels: doc.Metadata.Labels}
+	return nil
+}
+
+// MarshalJSON encodes the namespace with its name and labels as metadata
+func (n Namespace) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.document())
+}
+
+// UnmarshalJSON decodes a namespace encoded by MarshalJSON
+func (n *Namespace) UnmarshalJSON(b []byte) error {
+	var doc namespaceDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	return n.fromDocument(doc)
+}
+
+// MarshalYAML encodes the namespace with its name and labels as metadata
+func (n Namespace) MarshalYAML() (interface{}, error) {
+	return n.document(), nil
+}
+
+// UnmarshalYAML decodes a namespace encoded by MarshalYAML
+func (n *Namespace) UnmarshalYAML(value *yaml.Node) error {
+	var doc namespaceDocument
+	if err := value.Decode(&doc); err != nil {
+		return err
+	}
+	return n.fromDocument(doc)
+}
+
+// items returns the namespaces, roles and role bindings of the policy in the
+// order they are encoded
+func (p Policy) items() []interface{} {
+	items := make([]interface{}, 0, len(p.Namespaces)+len(p.Roles)+len(p.RoleBindings))
+	for _, n := range p.Namespaces {
+		items = append(items, n)
+	}
+	for _, r := range p.Roles {
+		items = append(items, r)
+	}
+	for _, r := range p.RoleBindings {
+		items = append(items, r)
+	}
+	return items
+}
+
+// MarshalJSON encodes the policy as List document with the namespaces, roles
+// and role bindings as items
+func (p Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Kind  string        `json:"kind"`
+		Items []interface{} `json:"items"`
+	}{kindList, p.items()})
+}
+
+// UnmarshalJSON decodes a List document or a single Role, RoleBinding or
+// Namespace and appends the objects to the policy
+func (p *Policy) UnmarshalJSON(b []byte) error {
+	var kind kindDocument
+	if err := json.Unmarshal(b, &kind); err != nil {
+		return err
+	}
+
+	switch kind.Kind {
+	case kindList:
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(b, &list); err != nil {
+			return err
+		}
+		for _, item := range list.Items {
+			if err := p.UnmarshalJSON(item); err != nil {
+				return err
+			}
+		}
+	case kindRole:
+		var r Role
+		if err := json.Unmarshal(b, &r); err != nil {
+			return err
+		}
+		p.Roles = append(p.Roles, r)
+	case kindRoleBinding:
+		var r RoleBinding
+		if err := json.Unmarshal(b, &r); err != nil {
+			return err
+		}
+		p.RoleBindings = append(p.RoleBindings, r)
+	case kindNamespace:
+		var n Namespace
+		if err := json.Unmarshal(b, &n); err != nil {
+			return err
+		}
+		p.Namespaces = append(p.Namespaces, n)
+	default:
+		return fmt.Errorf("unknown kind %q", kind.Kind)
+	}
+	return nil
+}
+
+// MarshalYAML encodes the policy as List document like MarshalJSON
+func (p Policy) MarshalYAML() (interface{}, error) {
+	return struct {
+		Kind  string        `yaml:"kind"`
+		Items []interface{} `yaml:"items"`
+	}{kindList, p.items()}, nil
+}
+
+// UnmarshalYAML decodes a List document or a single Role, RoleBinding or
+// Namespace and appends the objects to the policy
+func (p *Policy) UnmarshalYAML(value *yaml.Node) error {
+	var kind kindDocument
+	if err := value.Decode(&kind); err != nil {
+		return err
+	}
+
+	switch kind.Kind {
+	case kindList:
+		var list struct {
+			Items []yaml.Node `yaml:"items"`
+		}
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		for i := range list.Items {
+			if err := p.UnmarshalYAML(&list.Items[i]); err != nil {
+				return err
+			}
+		}
+	case kindRole:
+		var r Role
+		if err := value.Decode(&r); err != nil {
+			return err
+		}
+		p.Roles = append(p.Roles, r)
+	case kindRoleBinding:
+		var r RoleBinding
+		if err := value.Decode(&r); err != nil {
+			return err
+		}
+		p.RoleBindings = append(p.RoleBindings, r)
+	case kindNamespace:
+		var n Namespace
+		if err := value.Decode(&n); err != nil {
+			return err
+		}
+		p.Namespaces = append(p.Namespaces, n)
+	default:
+		return fmt.Errorf("unknown kind %q", kind.Kind)
+	}
+	return nil
+}
+
+// ExportJSON writes the policy of the Authorizer as indented List document
+func (a *Authorizer) ExportJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a.Policy())
+}
+
+// ImportJSON reads a stream of JSON documents as written by ExportJSON and
+// replaces the policy of the Authorizer with them, see SetPolicy. Besides List
+// documents, single Roles, RoleBindings and Namespaces are accepted.
+func (a *Authorizer) ImportJSON(r io.Reader) error {
+	l := newPolicyLoader()
+	if err := l.readJSON("", r); err != nil {
+		return err
+	}
+	return a.SetPolicy(l.policy)
+}
+
+// WriteYAML writes the policy of the Authorizer as a stream of YAML documents
+// in the format of example.yaml. The namespaces, roles and role bindings are
+// written in this order and sorted by name, so the output is deterministic and
+// can be loaded again with LoadYAML.
+func (a *Authorizer) WriteYAML(w io.Writer) error {
+	// The encoder fails to close an empty stream
+	items := a.Policy().items()
+	if len(items) == 0 {
+		return nil
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// LoadYAML reads a stream of YAML documents like example.yaml and replaces the
+// policy of the Authorizer with them, see SetPolicy. List documents are
+// accepted as well.
+func (a *Authorizer) LoadYAML(r io.Reader) error {
+	l := newPolicyLoader()
+	if err := l.readYAML("", r); err != nil {
+		return err
+	}
+	return a.SetPolicy(l.policy)
+}
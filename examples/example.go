@@ -4,11 +4,13 @@ import (
 	"context"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 
 	"github.com/djboris9/rbac"
+	"github.com/djboris9/rbac/rbacmetrics"
 )
 
 func main() {
@@ -35,6 +37,23 @@ func main() {
 		}},
 	})
 
+	authz.SetRole(rbac.Role{
+		Name: "health-checker",
+		Rules: []rbac.Rule{{
+			Verbs:           []string{"get"},
+			NonResourceURLs: []string{"/healthz", "/debug/*"},
+		}},
+	})
+
+	authz.SetRoleBinding(rbac.RoleBinding{
+		Name: "health-checking-for-all",
+		Role: "health-checker",
+		Subjects: []rbac.Subject{{
+			Name: "system:authenticated",
+			Kind: rbac.Group,
+		}},
+	})
+
 	authz.SetRoleBinding(rbac.RoleBinding{
 		Name: "states-reading-for-all",
 		Role: "read-states",
@@ -60,10 +79,16 @@ func main() {
 		}},
 	})
 
+	// Record metrics of the authorization decisions
+	metrics := rbac.NewMetricsRecorder()
+	authz.SetMetrics(metrics)
+
 	// Setup HTTP Handler, using our authorizer
 	srv := Handlers{authz: authz}
 	mux := http.NewServeMux()
 	mux.Handle("/states/", srv.Auth(http.HandlerFunc(srv.GetStates)))
+	mux.Handle("/healthz", srv.Auth(http.HandlerFunc(srv.GetStates)))
+	mux.Handle("/metrics", rbacmetrics.Handler(metrics))
 
 	// Just get all nodes
 	r := httptest.NewRequest("get", "/states/-/", nil)
@@ -98,6 +123,25 @@ func main() {
 	w = httptest.NewRecorder()
 	mux.ServeHTTP(w, r)
 	PrintResult(w)
+
+	// Check the health as authenticated user
+	r = httptest.NewRequest("get", "/healthz", nil)
+	r.Header.Add("X-User", "stephen")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	PrintResult(w)
+
+	// Try to check the health, unauthenticated
+	r = httptest.NewRequest("get", "/healthz", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	PrintResult(w)
+
+	// Show the metrics of the decisions above
+	r = httptest.NewRequest("get", "/metrics", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	PrintResult(w)
 }
 
 // Handlers implement http handlers that can use the rbac authorizer
@@ -160,32 +204,44 @@ func Authenticate(h http.Header) []rbac.Subject {
 }
 
 // Auth implements an RBAC authorizer by processing the request URLs.
-// The URI format is /{resource}/{namespace}/{resourceName}...
+// The URI format is /{resource}/{namespace}/{resourceName}... Other URIs
+// such as /healthz are evaluated as non-resource URLs.
 func (h Handlers) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract subject
 		subject := Authenticate(r.Header)
 
-		// Extract request attributes
-		components := strings.SplitN(r.URL.Path, "/", 4)
-		if len(components) != 4 {
-			w.WriteHeader(http.StatusBadRequest)
-			return
+		// Build the authorization request, conditions can use the client IP
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		req := rbac.Request{
+			Verb:     strings.ToLower(r.Method),
+			Subjects: subject,
+			Extra:    map[string]string{"ip": ip},
 		}
 
-		namespace := components[2]
-		if namespace == "-" {
-			namespace = ""
-		}
+		components := strings.SplitN(r.URL.Path, "/", 4)
+		if len(components) == 4 {
+			namespace := components[2]
+			if namespace == "-" {
+				namespace = ""
+			}
 
-		rbacResource := rbac.Resource{
-			Namespace:    namespace,
-			Resource:     components[1],
-			ResourceName: components[3],
+			req.Resource = rbac.Resource{
+				Namespace:    namespace,
+				Resource:     components[1],
+				ResourceName: components[3],
+			}
+		} else {
+			req.Path = r.URL.Path
 		}
 
 		// Evaluate authorization
-		result := h.authz.Eval(strings.ToLower(r.Method), subject, rbacResource)
+		result, err := h.authz.EvalContext(r.Context(), req)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		if !result.Success {
 			w.WriteHeader(http.StatusForbidden)
 			w.Write([]byte(result.String()))
@@ -0,0 +1,121 @@
+package rbac
+
+import (
+	"sort"
+	"time"
+)
+
+// EventType represents the kind of an Event
+type EventType int
+
+const (
+	_ EventType = iota // Initial value is invalid to prevent using not initialized fields
+
+	// RoleBindingExpired is emitted when an expired RoleBinding was removed
+	RoleBindingExpired
+
+	// PolicyReloaded is emitted when a Reloader replaced the policy
+	PolicyReloaded
+
+	// PolicyReloadFailed is emitted when a Reloader failed to load changed
+	// policy files and kept the current policy
+	PolicyReloadFailed
+)
+
+func (t EventType) String() string {
+	if t < RoleBindingExpired || t > PolicyReloadFailed {
+		return ""
+	}
+
+	return []string{"RoleBindingExpired", "PolicyReloaded", "PolicyReloadFailed"}[t-1]
+}
+
+// Event represents a change of the Authorizer that wasn't requested by a caller.
+// Name is the name of the affected RoleBinding or the reloaded directory and
+// Err is set for failures.
+type Event struct {
+	Type EventType
+	Name string
+	Time time.Time
+	Err  error
+}
+
+// SetEventHandler registers a function that is called for every Event of the
+// Authorizer. Passing nil removes the handler.
+func (a *Authorizer) SetEventHandler(handler func(Event)) {
+	a.Lock()
+	a.onEvent = handler
+	a.Unlock()
+}
+
+// emit passes an Event to the event handler, if any
+func (a *Authorizer) emit(e Event) {
+	a.RLock()
+	handler := a.onEvent
+	a.RUnlock()
+
+	if handler != nil {
+		handler(e)
+	}
+}
+
+// PruneExpired removes all RoleBindings whose NotAfter time has passed and
+// returns their names. A RoleBindingExpired event is emitted for every removed
+// RoleBinding.
+func (a *Authorizer) PruneExpired() []string {
+	var events []Event
+
+	a.Lock()
+	now := a.clock()
+	for name, rb := range a.rolebindings {
+		if !rb.NotAfter.IsZero() && !now.Before(rb.NotAfter) {
+			a.deleteRoleBinding(name)
+			events = append(events, Event{Type: RoleBindingExpired, Name: name, Time: now})
+		}
+	}
+	if len(events) > 0 {
+		a.changed()
+	}
+	handler := a.onEvent
+	a.Unlock()
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+
+	names := make([]string, 0, len(events))
+	for _, e := range events {
+		names = append(names, e.Name)
+		if handler != nil {
+			handler(e)
+		}
+	}
+	return names
+}
+
+// DefaultJanitorInterval is the interval StartJanitor uses for non-positive
+// intervals
+const DefaultJanitorInterval = time.Minute
+
+// StartJanitor calls PruneExpired periodically in the background until the
+// returned stop function is called. If the interval isn't positive,
+// DefaultJanitorInterval is used.
+func (a *Authorizer) StartJanitor(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.PruneExpired()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
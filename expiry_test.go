@@ -0,0 +1,89 @@
+package rbac
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRBACExpiringBindings tests the evaluation and pruning of time-bound RoleBindings
+func TestRBACExpiringBindings(t *testing.T) {
+	now := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	a := New()
+	a.SetClock(func() time.Time { return now })
+
+	var events []Event
+	a.SetEventHandler(func(e Event) { events = append(events, e) })
+
+	err := a.SetRole(Role{Name: "admin", Rules: []Rule{{Verbs: []string{"delete"}, Resources: []string{"nodes"}}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "invalid", Role: "admin", Subjects: []Subject{{Name: "bofh", Kind: User}},
+		NotBefore: now, NotAfter: now.Add(-time.Hour)})
+	if err == nil {
+		t.Fatal("SetRoleBinding should fail if NotAfter is before NotBefore")
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "break-glass", Role: "admin", Subjects: []Subject{{Name: "bofh", Kind: User}},
+		NotBefore: now.Add(time.Hour), NotAfter: now.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "on-call", Role: "admin", Subjects: []Subject{{Name: "oncall", Kind: User}},
+		NotAfter: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	bofh := []Subject{{Name: "bofh", Kind: User}}
+	oncall := []Subject{{Name: "oncall", Kind: User}}
+	resource := Resource{Resource: "nodes"}
+
+	if res := a.Eval("delete", bofh, resource); res.Success {
+		t.Errorf("Should not validate before NotBefore, but did: %s", res)
+	}
+	res := a.Eval("delete", oncall, resource)
+	if !res.Success {
+		t.Fatalf("Should validate, but didn't: %s", res)
+	}
+	if !res.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("Result should expire with the binding, got %s", res.Expires)
+	}
+
+	now = now.Add(time.Hour)
+	if res := a.Eval("delete", bofh, resource); !res.Success {
+		t.Errorf("Should validate after NotBefore, but didn't: %s", res)
+	}
+	if res := a.Eval("delete", oncall, resource); res.Success {
+		t.Errorf("Should not validate after NotAfter, but did: %s", res)
+	}
+
+	pruned := a.PruneExpired()
+	if len(pruned) != 1 || pruned[0] != "on-call" {
+		t.Fatalf("Expected on-call to be pruned, got %q", pruned)
+	}
+	if len(events) != 1 || events[0].Type != RoleBindingExpired || events[0].Name != "on-call" {
+		t.Fatalf("Expected an expiry event for on-call, got %v", events)
+	}
+	if a.GetRoleBinding("on-call").Name != "" || a.GetRoleBinding("break-glass").Name == "" {
+		t.Fatal("Only on-call should have been removed")
+	}
+
+	// The janitor prunes in the background
+	now = now.Add(time.Hour)
+	stop := a.StartJanitor(time.Millisecond)
+	defer stop()
+	for i := 0; i < 1000 && a.GetRoleBinding("break-glass").Name != ""; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if a.GetRoleBinding("break-glass").Name != "" {
+		t.Fatal("Janitor should have removed break-glass")
+	}
+
+	// Non-positive intervals use the default instead of panicking
+	for _, interval := range []time.Duration{0, -time.Second} {
+		a.StartJanitor(interval)()
+	}
+}
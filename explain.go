@@ -0,0 +1,195 @@
+package rbac
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BindingExplanation describes why a RoleBinding granted a request or why it
+// didn't
+type BindingExplanation struct {
+	RoleBinding string
+	Role        string
+	Granted     bool
+	Reason      string
+}
+
+// Explanation represents the result of a request together with the
+// explanations of all RoleBindings in evaluation order
+type Explanation struct {
+	Result   Result
+	Bindings []BindingExplanation
+}
+
+func (e Explanation) String() string {
+	var b strings.Builder
+	b.WriteString(e.Result.String())
+	b.WriteString("\n")
+	for _, be := range e.Bindings {
+		mark := "-"
+		if be.Granted {
+			mark = "+"
+		}
+		fmt.Fprintf(&b, "  %s %s (role %s): %s\n", mark, be.RoleBinding, be.Role, be.Reason)
+	}
+	return b.String()
+}
+
+// Explain evaluates a request like EvalContext and explains for every
+// RoleBinding why it applies or not. Unlike Eval, all RoleBindings are
+// evaluated, so every RoleBinding that would grant the request is marked as
+// granted and the Result is attributed to the first one. The subjects are used
+// as they are, the SubjectResolver and AuditSink aren't called.
+func (a *Authorizer) Explain(req Request) Explanation {
+	a.RLock()
+	defer a.RUnlock()
+
+	var now time.Time
+	e := Explanation{Result: a.evalGrants(req, a.grants(req.Subjects, &now), &now)}
+	namespace := req.Resource.Namespace
+	if req.Path != "" {
+		namespace = ""
+	}
+	ancestors := a.ancestors(namespace)
+
+	for _, name := range a.bindingOrder {
+		rb := a.rolebindings[name]
+		be := BindingExplanation{RoleBinding: name, Role: rb.Role}
+
+		subjects := matchAllSubjects(rb.Subjects, req.Subjects)
+		role, roleOk := a.roles[rb.Role]
+		scope, scopeOk := a.matchScope(rb, namespace, ancestors)
+		switch {
+		case len(subjects) == 0:
+			be.Reason = "no subject matches"
+		case rb.timeBounded() && !rb.validAt(a.lazyNow(&now)):
+			be.Reason = fmt.Sprintf("not valid at %s", a.lazyNow(&now).Format(time.RFC3339))
+		case !roleOk:
+			be.Reason = "role doesn't exist"
+		case !scopeOk:
+			be.Reason = fmt.Sprintf("doesn't apply to namespace %q", namespace)
+		default:
+			g := grant{binding: rb, subject: subjects[len(subjects)-1], subjects: subjects, role: role, conditions: a.conditions[role.Name]}
+			res := a.evalGrants(req, []grant{g}, &now)
+			be.Granted = res.Success
+			if !res.Success {
+				be.Reason = explainRules(req, role, res)
+				break
+			}
+
+			be.Reason = fmt.Sprintf("rule %d grants to %s", res.Rule, Subject{Name: res.Subject, Kind: res.SubjectType})
+			if scope != "" && scope != namespace {
+				be.Reason += fmt.Sprintf(" through namespace %q", scope)
+			}
+		}
+		e.Bindings = append(e.Bindings, be)
+	}
+	return e
+}
+
+// explainRules returns why none of the rules of a role matched a request
+func explainRules(req Request, role Role, res Result) string {
+	if len(res.ConditionFailures) > 0 {
+		return strings.Join(res.ConditionFailures, "; ")
+	}
+
+	if len(role.Rules) == 0 {
+		return "role has no rules"
+	}
+
+	reasons := make([]string, len(role.Rules))
+	for i, rule := range role.Rules {
+		var mismatches []string
+		if !sContains(rule.Verbs, req.Verb, false) {
+			mismatches = append(mismatches, "verb")
+		}
+		if req.Path != "" {
+			if !nonResourceURLContains(rule.NonResourceURLs, req.Path) {
+				mismatches = append(mismatches, "path")
+			}
+		} else {
+			if !apiGroupContains(rule.APIGroups, req.Resource.APIGroup) {
+				mismatches = append(mismatches, "apiGroup")
+			}
+			if !resourceContains(rule.Resources, req.Resource.path()) {
+				mismatches = append(mismatches, "resource")
+			}
+			if !sContains(rule.ResourceNames, req.Resource.ResourceName, true) {
+				mismatches = append(mismatches, "resourceName")
+			}
+		}
+		reasons[i] = fmt.Sprintf("rule %d: %s differs", i, strings.Join(mismatches, ", "))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// WhoCan returns the permissions of all subjects of the RoleBindings to apply
+// the verb to the resource, evaluated for each subject on its own like
+// EffectivePermissions does. Conditions are assumed to be satisfied and
+// RoleBindings to be valid at any time.
+func (a *Authorizer) WhoCan(verb string, resource Resource) []Permission {
+	return a.permissions(Domain{Verbs: []string{verb}, Namespaces: []string{resource.Namespace}, Resources: []Resource{resource}})
+}
+
+// WhoCanNonResource is the same as WhoCan for a non-resource URL
+func (a *Authorizer) WhoCanNonResource(verb string, path string) []Permission {
+	return a.permissions(Domain{Verbs: []string{verb}, Paths: []string{path}})
+}
+
+// permissions returns the effective permissions of the policy of the
+// Authorizer using its namespace hierarchy. The subjects of the policy are
+// used if the Domain has none.
+func (a *Authorizer) permissions(d Domain) []Permission {
+	p := a.Policy()
+	if len(d.Subjects) == 0 {
+		d.Subjects = PolicyDomain(p).Subjects
+	}
+
+	a.RLock()
+	parent := a.parent
+	a.RUnlock()
+
+	// The policy of an Authorizer is valid, so this doesn't fail
+	permissions, _ := effectivePermissions(p, d, parent)
+	return permissions
+}
+
+// GrantedRule represents a rule granted to a subject through a RoleBinding
+// that applies at Namespace
+type GrantedRule struct {
+	RoleBinding string
+	Role        string
+	Namespace   string
+	Subject     Subject
+	Rule        Rule
+}
+
+// RulesFor returns the rules that apply to the subjects in a namespace in
+// evaluation order. Only RoleBindings that are currently valid are considered.
+// An empty namespace returns the rules of global RoleBindings.
+func (a *Authorizer) RulesFor(subject []Subject, namespace string) []GrantedRule {
+	a.RLock()
+	defer a.RUnlock()
+
+	var now time.Time
+	var ret []GrantedRule
+	ancestors := a.ancestors(namespace)
+	for _, g := range a.grants(subject, &now) {
+		scope, ok := a.matchScope(g.binding, namespace, ancestors)
+		if !ok {
+			continue
+		}
+
+		for _, rule := range g.role.Rules {
+			ret = append(ret, GrantedRule{
+				RoleBinding: g.binding.Name,
+				Role:        g.role.Name,
+				Namespace:   scope,
+				Subject:     g.subject,
+				Rule:        rule,
+			})
+		}
+	}
+	return ret
+}
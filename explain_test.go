@@ -0,0 +1,86 @@
+package rbac
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestExplain tests the explanations of granted and denied requests
+func TestExplain(t *testing.T) {
+	a := createExtensiveAuthorizer()
+
+	subjects := []Subject{{Name: "bofh", Kind: User}, {Name: "superusers", Kind: Group}}
+	e := a.Explain(Request{Verb: "get", Subjects: subjects, Resource: Resource{Namespace: "linux", Resource: "nodes"}})
+	if !e.Result.Success || e.Result.RoleBinding != "global-node-watchers" {
+		t.Fatalf("Request should be granted by global-node-watchers, got %s", e.Result)
+	}
+	if len(e.Bindings) != 3 {
+		t.Fatalf("Expected 3 explained RoleBindings, got %d", len(e.Bindings))
+	}
+	for i, granted := range []bool{true, true, false} {
+		if e.Bindings[i].Granted != granted {
+			t.Errorf("RoleBinding %s should be granted: %t", e.Bindings[i].RoleBinding, granted)
+		}
+	}
+	if e.Bindings[2].Reason != "no subject matches" {
+		t.Errorf("Unexpected reason %q", e.Bindings[2].Reason)
+	}
+
+	e = a.Explain(Request{Verb: "delete", Subjects: subjects[:1], Resource: Resource{Namespace: "linux", Resource: "nodes", Subresource: "states", ResourceName: "windows"}})
+	if e.Result.Success {
+		t.Fatalf("Request shouldn't be granted, got %s", e.Result)
+	}
+	expected := "rule 0: verb, resource differs; rule 1: resourceName differs"
+	if e.Bindings[1].Reason != expected {
+		t.Errorf("Expected reason %q, got %q", expected, e.Bindings[1].Reason)
+	}
+
+	e = a.Explain(Request{Verb: "get", Subjects: subjects[:1], Resource: Resource{Namespace: "windows", Resource: "nodes"}})
+	if e.Bindings[1].Reason != `doesn't apply to namespace "windows"` {
+		t.Errorf("Unexpected reason %q", e.Bindings[1].Reason)
+	}
+	if !strings.Contains(e.String(), "- linux-node-watchers (role node-watcher): doesn't apply") {
+		t.Errorf("Unexpected explanation:\n%s", e)
+	}
+}
+
+// TestWhoCan tests listing the subjects that are granted a request
+func TestWhoCan(t *testing.T) {
+	a := createExtensiveAuthorizer()
+
+	var who []string
+	for _, p := range a.WhoCan("update", Resource{Namespace: "linux", Resource: "nodes", Subresource: "states", ResourceName: "linux"}) {
+		who = append(who, p.Subject.String()+"@"+p.RoleBinding)
+	}
+	expected := "User:bofh@linux-node-watchers Group:superusers@global-node-watchers Group:system:core@linux-node-watchers ServiceAccount:integrator@linux-node-watchers"
+	if strings.Join(who, " ") != expected {
+		t.Errorf("Expected %q, got %q", expected, strings.Join(who, " "))
+	}
+
+	if p := a.WhoCan("list", Resource{Namespace: "windows", Resource: "locations"}); len(p) != 2 {
+		t.Errorf("Expected the superusers and auditor, got %v", p)
+	}
+	if p := a.WhoCanNonResource("get", "/healthz"); len(p) != 0 {
+		t.Errorf("Nobody should get /healthz, got %v", p)
+	}
+}
+
+// TestRulesFor tests listing the rules that apply to subjects
+func TestRulesFor(t *testing.T) {
+	a := createExtensiveAuthorizer()
+
+	rules := a.RulesFor([]Subject{{Name: "bofh", Kind: User}}, "linux")
+	if len(rules) != 2 || rules[0].RoleBinding != "linux-node-watchers" || rules[0].Namespace != "linux" {
+		t.Fatalf("Unexpected rules %+v", rules)
+	}
+	if rules[1].Rule.ResourceNames[0] != "linux" {
+		t.Errorf("Unexpected second rule %+v", rules[1].Rule)
+	}
+
+	if rules := a.RulesFor([]Subject{{Name: "bofh", Kind: User}}, ""); len(rules) != 0 {
+		t.Errorf("bofh shouldn't have global rules, got %+v", rules)
+	}
+	if rules := a.RulesFor([]Subject{{Name: "auditor", Kind: ServiceAccount}}, ""); len(rules) != 1 || rules[0].Role != "readonly" {
+		t.Errorf("Unexpected rules of the auditor %+v", rules)
+	}
+}
@@ -0,0 +1,161 @@
+package rbac
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// FuzzEval checks Eval, the decision cache, EvalBatch, Checker and Explain
+// against the reference evaluator on policies and requests derived from the
+// input, see policyGenerator and checkAgainstReference
+func FuzzEval(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("\x02\x01\x00\x03\x01\x02\x00\x01\x01\x03\x00\x02\x01\x01\x00\x00\x01\x02\x03"))
+	f.Add(bytes.Repeat([]byte{1, 2, 3, 5, 7}, 40))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		evalAgainstReference(t, data)
+	})
+}
+
+// FuzzPatterns checks the matching of resources, non-resource URLs and API
+// groups against the reference implementations. A policy with the patterns as
+// rule is evaluated by all evaluators as well.
+func FuzzPatterns(f *testing.F) {
+	f.Add("nodes/*", "nodes/states", "/debug/*", "apps")
+	f.Add("*/states", "pods/states", "/healthz", "*")
+	f.Add("*", "nodes", "*", "")
+	f.Add("nodes", "nodes/a/b", "/debug", "apps")
+	f.Fuzz(func(t *testing.T, resourcePattern, resource, urlPattern, group string) {
+		if got, expected := resourceContains([]string{resourcePattern}, resource), referenceResourceMatches(resourcePattern, resource); got != expected {
+			t.Fatalf("resourceContains(%q, %q) = %t, reference returned %t", resourcePattern, resource, got, expected)
+		}
+		if got, expected := nonResourceURLContains([]string{urlPattern}, resource), referenceURLMatches(urlPattern, resource); got != expected {
+			t.Fatalf("nonResourceURLContains(%q, %q) = %t, reference returned %t", urlPattern, resource, got, expected)
+		}
+		if got, expected := apiGroupContains([]string{group}, "apps"), group == "apps" || group == "*"; got != expected {
+			t.Fatalf("apiGroupContains(%q, apps) = %t", group, got)
+		}
+
+		res := Resource{Namespace: "linux", APIGroup: "apps", Resource: resource}
+		if i := strings.IndexByte(resource, '/'); i >= 0 {
+			res.Resource, res.Subresource = resource[:i], resource[i+1:]
+		}
+		p := Policy{
+			Roles: []Role{{Name: "patterns", Rules: []Rule{
+				{Verbs: []string{"get"}, APIGroups: []string{group}, Resources: []string{resourcePattern}},
+				{Verbs: []string{"get"}, NonResourceURLs: []string{urlPattern}},
+			}}},
+			RoleBindings: []RoleBinding{{Name: "patterns", Role: "patterns", Subjects: []Subject{{Name: "bofh", Kind: User}}}},
+		}
+		subjects := []Subject{{Name: "bofh", Kind: User}}
+		checkAgainstReference(t, p, nil, time.Now(), []Request{
+			{Verb: "get", Subjects: subjects, Resource: res},
+			{Verb: "get", Subjects: subjects, Path: resource},
+		})
+	})
+}
+
+// FuzzCompileCondition checks that compileCondition doesn't panic on arbitrary
+// expressions and that compiled conditions evaluate without panics and to the
+// same result every time, for attributes and extras derived from the input
+func FuzzCompileCondition(f *testing.F) {
+	f.Add(`attr.owner == subject.name`, "bofh", "10.0.0.1", int64(0))
+	f.Add(`hour() >= 9 && hour() < 17 && weekday() in [1, 2, 3, 4, 5]`, "", "", int64(1583316000))
+	f.Add(`cidr(attr.ip, "10.0.0.0/8") || cidr(extra.ip, "192.168.0.0/16")`, "ci", "192.168.1.2", int64(0))
+	f.Add(`!(verb in ["get", "list"]) && startsWith(path, "/debug") || endsWith(name, "-prod")`, "web-prod", "", int64(-1))
+	f.Add(`attr.replicas > 3 != (extra.level <= "2") && namespace == subject.kind`, "5", "1", int64(42))
+	f.Fuzz(func(t *testing.T, src, value, extra string, unix int64) {
+		c, err := compileCondition(src)
+		if err != nil {
+			return
+		}
+
+		env := &condEnv{
+			verb:    value,
+			subject: Subject{Name: value, Kind: User},
+			resource: Resource{Namespace: value, APIGroup: extra, Resource: "nodes", Subresource: extra, ResourceName: value,
+				Attributes: map[string]string{"owner": value, "ip": extra, "replicas": value, value: extra}},
+			path:  "/" + value,
+			extra: map[string]string{"ip": extra, "level": extra, extra: value},
+			now:   time.Unix(unix, 0).UTC(),
+		}
+		ok, err := c.eval(env)
+
+		c2, err2 := compileCondition(src)
+		if err2 != nil {
+			t.Fatalf("Compiling %q again failed with %q", src, err2)
+		}
+		for _, c := range []*condition{c, c2} {
+			ok2, err2 := c.eval(env)
+			if ok2 != ok || (err2 == nil) != (err == nil) || err != nil && err.Error() != err2.Error() {
+				t.Fatalf("Condition %q evaluated to %t, %v and to %t, %v", src, ok, err, ok2, err2)
+			}
+		}
+	})
+}
+
+// FuzzLoadYAML checks that LoadYAML doesn't panic and that loaded policies
+// survive writing and loading them again
+func FuzzLoadYAML(f *testing.F) {
+	example, err := os.ReadFile("example.yaml")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(string(example))
+	f.Add("kind: Role\nmetadata: {name: a}\nrules:\n- verbs: [get]\n  resources: ['*']\n  condition: attr.owner == subject.name\n")
+	f.Add("kind: RoleBinding\nmetadata: {name: a, namespace: ns}\nroleRef: {name: a}\nsubjects: [{kind: sa, name: ci}]\nnotAfter: 2020-01-02T03:04:05+02:00\n")
+	f.Add("kind: Namespace\nmetadata:\n  name: team\n  labels: {env: prod}\n")
+	f.Fuzz(func(t *testing.T, data string) {
+		a := New()
+		if err := a.LoadYAML(strings.NewReader(data)); err != nil {
+			return
+		}
+
+		var b bytes.Buffer
+		if err := a.WriteYAML(&b); err != nil {
+			t.Fatalf("WriteYAML failed with %q", err)
+		}
+		a2 := New()
+		if err := a2.LoadYAML(&b); err != nil {
+			t.Fatalf("Loading the written policy failed with %q:\n%s", err, b.String())
+		}
+		if p, p2 := a.Policy().documents(), a2.Policy().documents(); !reflect.DeepEqual(p, p2) {
+			t.Fatalf("Policy changed by writing and loading it:\n%v\n%v", p, p2)
+		}
+	})
+}
+
+// FuzzImportJSON checks that ImportJSON doesn't panic and that imported
+// policies survive exporting and importing them again
+func FuzzImportJSON(f *testing.F) {
+	example, err := json.Marshal(createExtensiveAuthorizer().Policy())
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(string(example))
+	f.Add(`{"kind":"Role","metadata":{"name":"a"},"rules":[{"verbs":["get"],"nonResourceURLs":["/debug/*"]}]}`)
+	f.Add(`{"kind":"RoleBinding","metadata":{"name":"a"},"roleRef":{"name":"a"},"subjects":[{"kind":"Group","name":"g"}],"namespaceSelector":{"env":"prod"}}`)
+	f.Fuzz(func(t *testing.T, data string) {
+		a := New()
+		if err := a.ImportJSON(strings.NewReader(data)); err != nil {
+			return
+		}
+
+		var b bytes.Buffer
+		if err := a.ExportJSON(&b); err != nil {
+			t.Fatalf("ExportJSON failed with %q", err)
+		}
+		a2 := New()
+		if err := a2.ImportJSON(&b); err != nil {
+			t.Fatalf("Importing the exported policy failed with %q:\n%s", err, b.String())
+		}
+		if p, p2 := a.Policy().documents(), a2.Policy().documents(); !reflect.DeepEqual(p, p2) {
+			t.Fatalf("Policy changed by exporting and importing it:\n%v\n%v", p, p2)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package rbac
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PermissionSelector selects effective permissions. Every non-empty field must
+// contain the respective value of a permission, empty fields match any value.
+// Resources are given as `resource` or `resource/subresource`. A selector with
+// resources only matches resource permissions and one with paths only matches
+// non-resource permissions.
+type PermissionSelector struct {
+	Subjects     []Subject     `json:"subjects,omitempty" yaml:"subjects,omitempty"`
+	SubjectKinds []SubjectKind `json:"subjectKinds,omitempty" yaml:"subjectKinds,omitempty"`
+	Verbs        []string      `json:"verbs,omitempty" yaml:"verbs,omitempty"`
+	Namespaces   []string      `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	APIGroups    []string      `json:"apiGroups,omitempty" yaml:"apiGroups,omitempty"`
+	Resources    []string      `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Paths        []string      `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
+// Matches returns true if the selector selects the permission
+func (s PermissionSelector) Matches(p Permission) bool {
+	if len(s.Subjects) > 0 && !containsSubject(s.Subjects, p.Subject) {
+		return false
+	}
+	if len(s.SubjectKinds) > 0 && !containsSubjectKind(s.SubjectKinds, p.Subject.Kind) {
+		return false
+	}
+	if len(s.Verbs) > 0 && !sContains(s.Verbs, p.Verb, false) {
+		return false
+	}
+
+	if p.Path != "" {
+		return len(s.Resources) == 0 && (len(s.Paths) == 0 || sContains(s.Paths, p.Path, false))
+	}
+	return len(s.Paths) == 0 &&
+		sContains(s.Namespaces, p.Resource.Namespace, true) &&
+		sContains(s.APIGroups, p.Resource.APIGroup, true) &&
+		sContains(s.Resources, p.Resource.path(), true)
+}
+
+// Invariant represents a property of a policy. No subject may hold an
+// effective permission selected by Match, except for the subjects listed by
+// Only. So `no ServiceAccount can delete in namespace prod` is expressed as:
+//
+//	name: no-serviceaccount-deletes-in-prod
+//	match:
+//	  subjectKinds: [ServiceAccount]
+//	  verbs: [delete]
+//	  namespaces: [prod]
+//
+// And `only group admins can update secrets` as:
+//
+//	name: only-admins-update-secrets
+//	match:
+//	  verbs: [update]
+//	  resources: [secrets]
+//	only:
+//	- {kind: Group, name: admins}
+type Invariant struct {
+	Name  string             `json:"name" yaml:"name"`
+	Match PermissionSelector `json:"match" yaml:"match"`
+	Only  []Subject          `json:"only,omitempty" yaml:"only,omitempty"`
+}
+
+// Violation represents an effective permission that violates an invariant
+type Violation struct {
+	Invariant  string     `json:"invariant"`
+	Permission Permission `json:"permission"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s (%s)", v.Invariant, v.Permission, v.Permission.RoleBinding)
+}
+
+// CheckInvariants enumerates the effective permissions of a policy and returns
+// the ones that violate an invariant as counterexamples, ordered by invariant.
+// The Domain of the policy is extended by the verbs, namespaces and resources
+// the invariants mention, so an invariant about `delete` in `prod` holds even
+// if the policy mentions neither. Like EffectivePermissions, conditions are
+// assumed to be satisfied and RoleBindings to be valid at any time. It fails if
+// the policy is invalid.
+func CheckInvariants(p Policy, invariants ...Invariant) ([]Violation, error) {
+	d := PolicyDomain(p)
+	for _, inv := range invariants {
+		d.extend(inv.Match)
+	}
+
+	permissions, err := EffectivePermissions(p, d)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Violation
+	for _, inv := range invariants {
+		for _, perm := range permissions {
+			if inv.Match.Matches(perm) && !containsSubject(inv.Only, perm.Subject) {
+				ret = append(ret, Violation{Invariant: inv.Name, Permission: perm})
+			}
+		}
+	}
+	return ret, nil
+}
+
+// extend adds the verbs, namespaces, resources and paths of a selector to the
+// Domain. Selected resources are added for the selected API groups or, if
+// there are none, for every API group of the Domain.
+func (d *Domain) extend(s PermissionSelector) {
+	d.Verbs = appendMissing(d.Verbs, s.Verbs...)
+	d.Namespaces = appendMissing(d.Namespaces, s.Namespaces...)
+	d.Paths = appendMissing(d.Paths, s.Paths...)
+
+	groups := s.APIGroups
+	if len(groups) == 0 {
+		groups = []string{""}
+		for _, r := range d.Resources {
+			groups = appendMissing(groups, r.APIGroup)
+		}
+	}
+
+	known := map[string]bool{}
+	for _, r := range d.Resources {
+		known[r.String()] = true
+	}
+	for _, group := range groups {
+		for _, res := range s.Resources {
+			r := Resource{APIGroup: group, Resource: res}
+			if i := strings.IndexByte(res, '/'); i >= 0 {
+				r.Resource, r.Subresource = res[:i], res[i+1:]
+			}
+			if !known[r.String()] {
+				known[r.String()] = true
+				d.Resources = append(d.Resources, r)
+			}
+		}
+	}
+
+	sort.Strings(d.Verbs)
+	sort.Strings(d.Namespaces)
+	sort.Strings(d.Paths)
+	sort.Slice(d.Resources, func(i, j int) bool { return resourceLess(d.Resources[i], d.Resources[j]) })
+}
+
+// appendMissing appends the values to `sl` that it doesn't contain yet
+func appendMissing(sl []string, values ...string) []string {
+	for _, v := range values {
+		if !sContains(sl, v, false) {
+			sl = append(sl, v)
+		}
+	}
+	return sl
+}
+
+// containsSubject returns true if `sl` contains the subject
+func containsSubject(sl []Subject, s Subject) bool {
+	for _, s2 := range sl {
+		if s2 == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsSubjectKind returns true if `sl` contains the subject kind
+func containsSubjectKind(sl []SubjectKind, k SubjectKind) bool {
+	for _, k2 := range sl {
+		if k2 == k {
+			return true
+		}
+	}
+	return false
+}
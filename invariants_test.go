@@ -0,0 +1,108 @@
+package rbac
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestCheckInvariants tests reporting counterexamples of invariants
+func TestCheckInvariants(t *testing.T) {
+	p := createExtensiveAuthorizer().Policy()
+
+	invariants := []Invariant{{
+		Name:  "no-serviceaccount-deletes-in-prod",
+		Match: PermissionSelector{SubjectKinds: []SubjectKind{ServiceAccount}, Verbs: []string{"delete"}, Namespaces: []string{"prod"}},
+	}, {
+		Name:  "no-serviceaccount-deletes-in-linux",
+		Match: PermissionSelector{SubjectKinds: []SubjectKind{ServiceAccount}, Verbs: []string{"delete"}, Namespaces: []string{"linux"}},
+	}, {
+		Name:  "only-superusers-update-states",
+		Match: PermissionSelector{Verbs: []string{"update"}, Resources: []string{"nodes/states"}},
+		Only:  []Subject{{Name: "superusers", Kind: Group}},
+	}, {
+		Name:  "nobody-reads-secrets",
+		Match: PermissionSelector{Resources: []string{"secrets"}},
+	}}
+
+	violations, err := CheckInvariants(p, invariants...)
+	if err != nil {
+		t.Fatalf("CheckInvariants failed with %q", err)
+	}
+
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.String())
+	}
+	expected := []string{
+		`no-serviceaccount-deletes-in-linux: ServiceAccount:integrator delete "linux":"nodes/states":"linux" (linux-node-watchers)`,
+		`only-superusers-update-states: User:bofh update "linux":"nodes/states":"linux" (linux-node-watchers)`,
+		`only-superusers-update-states: Group:system:core update "linux":"nodes/states":"linux" (linux-node-watchers)`,
+		`only-superusers-update-states: ServiceAccount:integrator update "linux":"nodes/states":"linux" (linux-node-watchers)`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected violations:\n%s", strings.Join(got, "\n"))
+	}
+
+	// A global wildcard rule violates invariants about resources the policy
+	// doesn't mention
+	p.Roles = append(p.Roles, Role{Name: "admin", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"*"}}}})
+	p.RoleBindings = append(p.RoleBindings, RoleBinding{Name: "admins", Role: "admin", Subjects: []Subject{{Name: "admins", Kind: Group}}})
+	violations, err = CheckInvariants(p, invariants[3])
+	if err != nil {
+		t.Fatalf("CheckInvariants failed with %q", err)
+	}
+	if len(violations) == 0 || violations[0].Permission.Subject.Name != "admins" || violations[0].Permission.Resource.Resource != "secrets" {
+		t.Errorf("Expected admins to read secrets, got %v", violations)
+	}
+
+	// A conditional rule doesn't make an unconditional violation after it
+	// look conditional
+	p = Policy{
+		Roles: []Role{{Name: "cleaner", Rules: []Rule{
+			{Verbs: []string{"delete"}, Resources: []string{"jobs"}, Condition: `attr.owner == subject.name`},
+			{Verbs: []string{"delete"}, Resources: []string{"jobs"}},
+		}}},
+		RoleBindings: []RoleBinding{{Name: "cleaners", Role: "cleaner", Namespace: "prod",
+			Subjects: []Subject{{Name: "ci", Kind: ServiceAccount}}}},
+	}
+	violations, err = CheckInvariants(p, invariants[0])
+	if err != nil {
+		t.Fatalf("CheckInvariants failed with %q", err)
+	}
+	if len(violations) != 1 || violations[0].Permission.Condition != "" {
+		t.Errorf("Expected an unconditional violation, got %v", violations)
+	}
+}
+
+// TestInvariantYAML tests decoding invariants from YAML
+func TestInvariantYAML(t *testing.T) {
+	data := `
+name: only-admins-update-secrets
+match:
+  subjectKinds: [User, ServiceAccount]
+  verbs: [update]
+  resources: [secrets]
+only:
+- {kind: Group, name: admins}
+`
+	var inv Invariant
+	if err := yaml.Unmarshal([]byte(data), &inv); err != nil {
+		t.Fatalf("Decoding failed with %q", err)
+	}
+
+	expected := Invariant{
+		Name: "only-admins-update-secrets",
+		Match: PermissionSelector{
+			SubjectKinds: []SubjectKind{User, ServiceAccount},
+			Verbs:        []string{"update"},
+			Resources:    []string{"secrets"},
+		},
+		Only: []Subject{{Name: "admins", Kind: Group}},
+	}
+	if !reflect.DeepEqual(inv, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, inv)
+	}
+}
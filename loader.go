@@ -0,0 +1,371 @@
+package rbac
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// policyLoader collects the objects of policy files and remembers where they
+// were defined in order to report duplicates
+type policyLoader struct {
+	policy  Policy
+	defined map[string]string // sources of the objects by kind and name
+}
+
+func newPolicyLoader() *policyLoader {
+	return &policyLoader{defined: map[string]string{}}
+}
+
+// source returns the position of an object for error messages. The file is
+// empty for streams that aren't read from a file and the line is zero if it is
+// unknown.
+func source(file string, line int) string {
+	switch {
+	case file == "":
+		return fmt.Sprintf("line %d", line)
+	case line == 0:
+		return file
+	default:
+		return fmt.Sprintf("%s:%d", file, line)
+	}
+}
+
+// readYAML reads a stream of YAML documents
+func (l *policyLoader) readYAML(file string, r io.Reader) error {
+	dec := yaml.NewDecoder(r)
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err == io.EOF {
+			return nil
+		} else if err != nil {
+			if file == "" {
+				return err
+			}
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		// Skip empty documents
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+
+		if err := l.addYAML(file, doc.Content[0]); err != nil {
+			return err
+		}
+	}
+}
+
+// addYAML adds the object of a YAML node or the items of a List
+func (l *policyLoader) addYAML(file string, node *yaml.Node) error {
+	var kind kindDocument
+	if err := node.Decode(&kind); err != nil {
+		return fmt.Errorf("%s: %s", source(file, node.Line), err)
+	}
+
+	if kind.Kind == kindList {
+		var list struct {
+			Items []yaml.Node `yaml:"items"`
+		}
+		if err := node.Decode(&list); err != nil {
+			return fmt.Errorf("%s: %s", source(file, node.Line), err)
+		}
+		for i := range list.Items {
+			if err := l.addYAML(file, &list.Items[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var p Policy
+	if err := p.UnmarshalYAML(node); err != nil {
+		return fmt.Errorf("%s: %s", source(file, node.Line), err)
+	}
+	return l.add(p, source(file, node.Line))
+}
+
+// readJSON reads a stream of JSON documents. The items of List documents are
+// reported at the line of the List.
+func (l *policyLoader) readJSON(file string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			var line int
+			if se, ok := err.(*json.SyntaxError); ok {
+				line = lineAt(data, se.Offset)
+			}
+			return fmt.Errorf("%s: %s", source(file, line), err)
+		}
+
+		src := source(file, lineAt(data, dec.InputOffset()-int64(len(raw))))
+		var p Policy
+		if err := p.UnmarshalJSON(raw); err != nil {
+			return fmt.Errorf("%s: %s", src, err)
+		}
+		if err := l.add(p, src); err != nil {
+			return err
+		}
+	}
+}
+
+// lineAt returns the line of an offset in `data`
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// add validates the objects of a policy defined at `src` and adds them
+func (l *policyLoader) add(p Policy, src string) error {
+	for _, r := range p.Roles {
+		if _, err := compileRole(r); err != nil {
+			return fmt.Errorf("%s: Role %q: %s", src, r.Name, err)
+		}
+		if err := l.define(kindRole, r.Name, src); err != nil {
+			return err
+		}
+		l.policy.Roles = append(l.policy.Roles, r)
+	}
+
+	for _, r := range p.RoleBindings {
+		if err := validateRoleBinding(r); err != nil {
+			return fmt.Errorf("%s: RoleBinding %q: %s", src, r.Name, err)
+		}
+		if err := l.define(kindRoleBinding, r.Name, src); err != nil {
+			return err
+		}
+		l.policy.RoleBindings = append(l.policy.RoleBindings, r)
+	}
+
+	for _, n := range p.Namespaces {
+		if err := validateNamespace(n); err != nil {
+			return fmt.Errorf("%s: Namespace %q: %s", src, n.Name, err)
+		}
+		if err := l.define(kindNamespace, n.Name, src); err != nil {
+			return err
+		}
+		l.policy.Namespaces = append(l.policy.Namespaces, n)
+	}
+	return nil
+}
+
+// define records the source of an object and fails if it was already defined
+func (l *policyLoader) define(kind, name, src string) error {
+	key := kind + "/" + name
+	if prev, ok := l.defined[key]; ok {
+		return fmt.Errorf("%s: duplicate %s %q, already defined at %s", src, kind, name, prev)
+	}
+	l.defined[key] = src
+	return nil
+}
+
+// readFile reads a policy file depending on its extension
+func (l *policyLoader) readFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return l.readYAML(file, f)
+	case ".json":
+		return l.readJSON(file, f)
+	default:
+		return fmt.Errorf("%s: unsupported policy file, expected .yaml, .yml or .json", file)
+	}
+}
+
+// ReadPolicyFiles reads the Roles, RoleBindings and Namespaces of YAML and JSON
+// files. Errors, such as objects defined in more than one file, are reported
+// with the file and line of the object.
+func ReadPolicyFiles(files ...string) (Policy, error) {
+	l := newPolicyLoader()
+	for _, file := range files {
+		if err := l.readFile(file); err != nil {
+			return Policy{}, err
+		}
+	}
+	return l.policy, nil
+}
+
+// ReadPolicyGlob reads the policy files matching a pattern as described by
+// filepath.Match, see ReadPolicyFiles
+func ReadPolicyGlob(pattern string) (Policy, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return Policy{}, err
+	}
+	return ReadPolicyFiles(files...)
+}
+
+// ReadPolicyDir reads all `*.yaml`, `*.yml` and `*.json` files of a directory
+// and its subdirectories in lexical order, see ReadPolicyFiles. Hidden files and
+// directories are skipped.
+func ReadPolicyDir(dir string) (Policy, error) {
+	var files []string
+	err := walkPolicyFiles(dir, func(path string, info os.FileInfo) {
+		files = append(files, path)
+	})
+	if err != nil {
+		return Policy{}, err
+	}
+	return ReadPolicyFiles(files...)
+}
+
+// ReadPolicy reads policy files and directories, see ReadPolicyFiles and
+// ReadPolicyDir. Objects must be unique across all of them.
+func ReadPolicy(paths ...string) (Policy, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return Policy{}, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = walkPolicyFiles(path, func(path string, info os.FileInfo) {
+			files = append(files, path)
+		})
+		if err != nil {
+			return Policy{}, err
+		}
+	}
+	return ReadPolicyFiles(files...)
+}
+
+// walkPolicyFiles calls `fn` for every policy file in a directory
+func walkPolicyFiles(dir string, fn func(path string, info os.FileInfo)) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+			fn(path, info)
+		}
+		return nil
+	})
+}
+
+// LoadDir reads the policy files of a directory with ReadPolicyDir and replaces
+// the policy of the Authorizer with them. If a file is invalid, the policy
+// isn't changed.
+func (a *Authorizer) LoadDir(dir string) error {
+	p, err := ReadPolicyDir(dir)
+	if err != nil {
+		return err
+	}
+	return a.SetPolicy(p)
+}
+
+// Reloader loads the policy files of a directory into an Authorizer whenever
+// they change. Changes are detected by polling the names, sizes and
+// modification times of the files. A PolicyReloaded or PolicyReloadFailed
+// event is emitted for every reload.
+type Reloader struct {
+	sync.Mutex
+	authz *Authorizer
+	dir   string
+	state string
+}
+
+// NewReloader instantiates a Reloader for the policy files of `dir`, see
+// ReadPolicyDir. The first call of Reload loads the files.
+func NewReloader(authz *Authorizer, dir string) *Reloader {
+	return &Reloader{authz: authz, dir: dir}
+}
+
+// Reload replaces the policy of the Authorizer if the policy files changed
+// since the last call and returns true if it did. If the files are invalid,
+// the current policy is kept and the error is returned. The files aren't
+// loaded again until they change.
+func (r *Reloader) Reload() (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var state strings.Builder
+	err := walkPolicyFiles(r.dir, func(path string, info os.FileInfo) {
+		fmt.Fprintf(&state, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+	})
+	if err == nil && state.String() == r.state {
+		return false, nil
+	}
+
+	if err == nil {
+		r.state = state.String()
+		err = r.authz.LoadDir(r.dir)
+	}
+
+	if err != nil {
+		r.authz.emit(Event{Type: PolicyReloadFailed, Name: r.dir, Time: r.authz.now(), Err: err})
+		return false, err
+	}
+
+	r.authz.emit(Event{Type: PolicyReloaded, Name: r.dir, Time: r.authz.now()})
+	return true, nil
+}
+
+// DefaultReloadInterval is the interval Reloader.Start uses for non-positive
+// intervals
+const DefaultReloadInterval = 10 * time.Second
+
+// Start calls Reload periodically in the background until the returned stop
+// function is called. Errors are reported as PolicyReloadFailed events. If the
+// interval isn't positive, DefaultReloadInterval is used.
+func (r *Reloader) Start(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,146 @@
+package rbac
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRolesYAML = `kind: Role
+metadata:
+  name: node-watcher
+rules:
+- verbs: ["get", "list"]
+  resources: ["nodes"]
+---
+kind: Role
+metadata:
+  name: readonly
+rules:
+- verbs: ["get"]
+  resources: ["nodes"]
+`
+
+const testBindingsJSON = `{"kind": "RoleBinding", "metadata": {"name": "watchers"}, "roleRef": {"name": "node-watcher"},
+  "subjects": [{"kind": "User", "name": "bofh"}]}
+{"kind": "List", "items": [{"kind": "Namespace", "metadata": {"name": "linux"}}]}
+`
+
+// writeTestFile writes a file below `dir` and creates its directory
+func writeTestFile(t *testing.T, dir, name, content string) {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Creating directory failed with %q", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Writing %s failed with %q", name, err)
+	}
+}
+
+// TestLoadDir tests loading a directory of policy files and the reporting of
+// duplicates and invalid objects
+func TestLoadDir(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rbac")
+	if err != nil {
+		t.Fatalf("TempDir failed with %q", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "team-a/roles.yaml", testRolesYAML)
+	writeTestFile(t, dir, "team-b/bindings.json", testBindingsJSON)
+	writeTestFile(t, dir, ".git/ignored.yaml", "invalid: [")
+	writeTestFile(t, dir, "README.md", "ignored")
+
+	a := New()
+	if err := a.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir failed with %q", err)
+	}
+	p := a.Policy()
+	if len(p.Roles) != 2 || len(p.RoleBindings) != 1 || len(p.Namespaces) != 1 {
+		t.Fatalf("Unexpected policy %+v", p)
+	}
+	if res := a.Eval("list", []Subject{{Name: "bofh", Kind: User}}, Resource{Resource: "nodes"}); !res.Success {
+		t.Errorf("Loaded policy should validate, but didn't: %s", res)
+	}
+
+	if _, err := ReadPolicyGlob(filepath.Join(dir, "team-*", "*.yaml")); err != nil {
+		t.Errorf("ReadPolicyGlob failed with %q", err)
+	}
+
+	tests := map[string]string{
+		"team-c/dup.yaml":    "kind: Namespace\nmetadata:\n  name: other\n---\nkind: Role\nmetadata:\n  name: readonly\nrules: []\n",
+		"team-c/bad.json":    `{"kind": "Role", "metadata": {"name": "bad"},` + "\n" + `"rules": [{"verbs": []}]}`,
+		"team-c/syntax.json": "{\n\"kind\": }",
+		"team-c/kind.yaml":   "kind: Pod\n",
+	}
+	expected := map[string]string{
+		"team-c/dup.yaml":    `dup.yaml:5: duplicate Role "readonly", already defined at ` + filepath.Join(dir, "team-a/roles.yaml") + ":8",
+		"team-c/bad.json":    `bad.json:1: Role "bad": Every rule needs at least a verb`,
+		"team-c/syntax.json": "syntax.json:2: invalid character",
+		"team-c/kind.yaml":   `kind.yaml:1: unknown kind "Pod"`,
+	}
+	for name, content := range tests {
+		writeTestFile(t, dir, name, content)
+		err := a.LoadDir(dir)
+		if err == nil || !strings.Contains(err.Error(), expected[name]) {
+			t.Errorf("LoadDir should fail with %q, got %v", expected[name], err)
+		}
+		os.Remove(filepath.Join(dir, name))
+	}
+
+	if len(a.Policy().Roles) != 2 {
+		t.Error("Failed loads should leave the policy unchanged")
+	}
+}
+
+// TestReloader tests that a Reloader swaps the policy on changes and keeps it
+// if the changed files are invalid
+func TestReloader(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rbac")
+	if err != nil {
+		t.Fatalf("TempDir failed with %q", err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFile(t, dir, "roles.yaml", testRolesYAML)
+
+	a := New()
+	var events []Event
+	a.SetEventHandler(func(e Event) { events = append(events, e) })
+
+	r := NewReloader(a, dir)
+	if changed, err := r.Reload(); !changed || err != nil {
+		t.Fatalf("First reload should load the policy, got %t, %v", changed, err)
+	}
+	if changed, err := r.Reload(); changed || err != nil {
+		t.Fatalf("Reload without changes shouldn't load, got %t, %v", changed, err)
+	}
+
+	writeTestFile(t, dir, "bindings.json", testBindingsJSON)
+	if changed, err := r.Reload(); !changed || err != nil {
+		t.Fatalf("Reload should load the new file, got %t, %v", changed, err)
+	}
+	if a.GetRoleBinding("watchers").Name == "" {
+		t.Error("RoleBinding should be loaded")
+	}
+
+	writeTestFile(t, dir, "bindings.json", testBindingsJSON+"{")
+	if changed, err := r.Reload(); changed || err == nil {
+		t.Fatalf("Reload should fail for invalid files, got %t, %v", changed, err)
+	}
+	if a.GetRoleBinding("watchers").Name == "" {
+		t.Error("Failed reloads should keep the policy")
+	}
+	if changed, err := r.Reload(); changed || err != nil {
+		t.Fatalf("Invalid files shouldn't be loaded again until they change, got %t, %v", changed, err)
+	}
+
+	if len(events) != 3 || events[0].Type != PolicyReloaded || events[2].Type != PolicyReloadFailed || events[2].Err == nil {
+		t.Errorf("Unexpected events %+v", events)
+	}
+	// Non-positive intervals use the default instead of panicking
+	for _, interval := range []time.Duration{0, -time.Second} {
+		r.Start(interval)()
+	}
+}
@@ -0,0 +1,54 @@
+package rbac
+
+import (
+	"bufio"
+	"io"
+)
+
+// WritePermissionMatrix writes the effective permissions of a policy over its
+// Domain, see EffectivePermissions, as a snapshot that can be committed and
+// reviewed. Every permission is written on its own line without alignment, so
+// a change of the policy only changes the lines of the permissions it affects:
+//
+//	# subject namespace resource resourceName verb -> roleBinding [if condition]
+//	Group:superusers - nodes - get -> global-node-watchers
+//	User:bofh linux nodes/states linux update -> linux-node-watchers
+//
+// The global scope and empty resource names are written as `-`, the API group
+// is appended to the resource like `deployments.apps` and non-resource URLs
+// are written in place of the resource. The lines are ordered by subject,
+// namespace, resource, path and verb. It fails if the policy is invalid.
+func WritePermissionMatrix(w io.Writer, p Policy) error {
+	permissions, err := EffectivePermissions(p, PolicyDomain(p))
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# subject namespace resource resourceName verb -> roleBinding [if condition]\n")
+	for _, perm := range permissions {
+		namespace, resource, name := "-", perm.Path, "-"
+		if perm.Path == "" {
+			resource = perm.Resource.Resource
+			if perm.Resource.APIGroup != "" {
+				resource += "." + perm.Resource.APIGroup
+			}
+			if perm.Resource.Subresource != "" {
+				resource += "/" + perm.Resource.Subresource
+			}
+			if perm.Resource.Namespace != "" {
+				namespace = perm.Resource.Namespace
+			}
+			if perm.Resource.ResourceName != "" {
+				name = perm.Resource.ResourceName
+			}
+		}
+
+		line := perm.Subject.String() + " " + namespace + " " + resource + " " + name + " " + perm.Verb + " -> " + perm.RoleBinding
+		if perm.Condition != "" {
+			line += " if " + perm.Condition
+		}
+		bw.WriteString(line + "\n")
+	}
+	return bw.Flush()
+}
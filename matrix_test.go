@@ -0,0 +1,71 @@
+package rbac
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the tests")
+
+// TestPermissionMatrix tests the permission matrix of example.yaml against
+// `example_permissions.list`. Run `go test -run TestPermissionMatrix -update`
+// to update it after changing example.yaml.
+func TestPermissionMatrix(t *testing.T) {
+	p, err := ReadPolicyFiles("example.yaml")
+	if err != nil {
+		t.Fatalf("Reading example.yaml failed with %q", err)
+	}
+
+	var b bytes.Buffer
+	if err := WritePermissionMatrix(&b, p); err != nil {
+		t.Fatalf("WritePermissionMatrix failed with %q", err)
+	}
+
+	if *updateGolden {
+		if err := os.WriteFile("example_permissions.list", b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden, err := os.ReadFile("example_permissions.list")
+	if err != nil {
+		t.Fatalf("Got error reading example_permissions.list: %q", err)
+	}
+	if !bytes.Equal(b.Bytes(), golden) {
+		t.Errorf("Permission matrix differs from example_permissions.list:\n%s", b.String())
+	}
+
+	// The matrix is the same for the policy of the extensive Authorizer, no
+	// matter in which order the objects are defined
+	p = createExtensiveAuthorizer().Policy()
+	for i, j := 0, len(p.RoleBindings)-1; i < j; i, j = i+1, j-1 {
+		p.RoleBindings[i], p.RoleBindings[j] = p.RoleBindings[j], p.RoleBindings[i]
+	}
+	var b2 bytes.Buffer
+	if err := WritePermissionMatrix(&b2, p); err != nil || b2.String() != b.String() {
+		t.Errorf("Matrix should be stable, got %v:\n%s", err, b2.String())
+	}
+
+	if !strings.Contains(b.String(), "\nUser:bofh linux nodes/states linux update -> linux-node-watchers\n") {
+		t.Errorf("Matrix should contain the update of bofh:\n%s", b.String())
+	}
+
+	// An unconditional rule isn't masked by a conditional one before it
+	p = Policy{
+		Roles: []Role{{Name: "editor", Rules: []Rule{
+			{Verbs: []string{"delete"}, Resources: []string{"docs"}, Condition: `attr.owner == subject.name`},
+			{Verbs: []string{"delete"}, Resources: []string{"docs"}},
+		}}},
+		RoleBindings: []RoleBinding{{Name: "editors", Role: "editor", Subjects: []Subject{{Name: "bofh", Kind: User}}}},
+	}
+	b.Reset()
+	if err := WritePermissionMatrix(&b, p); err != nil {
+		t.Fatalf("WritePermissionMatrix failed with %q", err)
+	}
+	if !strings.Contains(b.String(), "\nUser:bofh - docs - delete -> editors\n") {
+		t.Errorf("Matrix should contain the unconditional delete:\n%s", b.String())
+	}
+}
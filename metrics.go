@@ -0,0 +1,207 @@
+package rbac
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements of an Authorizer. The methods are called
+// synchronously and must not call the Authorizer. MetricsRecorder implements
+// it without further dependencies, other implementations can forward the
+// measurements to a metrics library.
+type Metrics interface {
+	// ObserveDecision is called for every evaluated request with the time it
+	// took to evaluate it
+	ObserveDecision(res Result, duration time.Duration)
+
+	// ObservePolicy is called with the number of Roles and RoleBindings after
+	// every policy change
+	ObservePolicy(roles, rolebindings int)
+}
+
+// SetMetrics registers Metrics that observe every evaluation and policy
+// change. Passing nil removes them.
+func (a *Authorizer) SetMetrics(m Metrics) {
+	a.Lock()
+	a.metrics = m
+	if m != nil {
+		m.ObservePolicy(len(a.roles), len(a.rolebindings))
+	}
+	a.Unlock()
+}
+
+// observe passes an evaluation that started at `start` to the Metrics, if any
+func observe(m Metrics, res Result, start time.Time) {
+	if m != nil {
+		m.ObserveDecision(res, time.Since(start))
+	}
+}
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the evaluation
+// latency histogram of a MetricsRecorder
+var DefaultLatencyBuckets = []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .1}
+
+// MetricsRecorder implements Metrics by counting decisions by verb, resource
+// and outcome, RoleBinding hits and the evaluation latency in a histogram. The
+// counters can be read with Snapshot and are exposed in the Prometheus text
+// format and through expvar by the rbacmetrics package. The granted requests
+// are also counted per rule and subject for UnusedPermissions, see Usage.
+type MetricsRecorder struct {
+	sync.Mutex
+	started      time.Time
+	decisions    map[decisionLabels]uint64
+	bindingHits  map[string]uint64
+	usage        map[UsageKey]uint64
+	buckets      []float64
+	bucketCounts []uint64
+	latencySum   float64
+	latencyCount uint64
+	roles        int
+	rolebindings int
+}
+
+// decisionLabels represents the labels of the decision counter
+type decisionLabels struct {
+	verb     string
+	resource string
+	allowed  bool
+}
+
+// nonResourceLabel is the resource label of non-resource URL decisions
+const nonResourceLabel = "nonResourceURL"
+
+// NewMetricsRecorder instantiates a MetricsRecorder using DefaultLatencyBuckets
+func NewMetricsRecorder() *MetricsRecorder {
+	return &MetricsRecorder{
+		started:      time.Now(),
+		decisions:    map[decisionLabels]uint64{},
+		bindingHits:  map[string]uint64{},
+		usage:        map[UsageKey]uint64{},
+		buckets:      DefaultLatencyBuckets,
+		bucketCounts: make([]uint64, len(DefaultLatencyBuckets)),
+	}
+}
+
+// ObserveDecision counts the decision and its latency. Non-resource URL
+// requests are counted with the resource nonResourceURL to keep the number of
+// series bounded.
+func (m *MetricsRecorder) ObserveDecision(res Result, duration time.Duration) {
+	labels := decisionLabels{verb: res.Request.Verb, resource: nonResourceLabel, allowed: res.Success}
+	if res.Request.Path == "" {
+		r := res.Request.Resource
+		labels.resource = r.Resource
+		if r.APIGroup != "" {
+			labels.resource += "." + r.APIGroup
+		}
+		if r.Subresource != "" {
+			labels.resource += "/" + r.Subresource
+		}
+	}
+	seconds := duration.Seconds()
+
+	m.Lock()
+	defer m.Unlock()
+	m.decisions[labels]++
+	if res.Success {
+		m.bindingHits[res.RoleBinding]++
+		m.usage[UsageKey{RoleBinding: res.RoleBinding, Rule: res.Rule, Subject: Subject{Name: res.Subject, Kind: res.SubjectType}}]++
+	}
+	for i, le := range m.buckets {
+		if seconds <= le {
+			m.bucketCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// ObservePolicy records the size of the policy
+func (m *MetricsRecorder) ObservePolicy(roles, rolebindings int) {
+	m.Lock()
+	m.roles, m.rolebindings = roles, rolebindings
+	m.Unlock()
+}
+
+// BindingHits returns the number of granted requests per RoleBinding
+func (m *MetricsRecorder) BindingHits() map[string]uint64 {
+	m.Lock()
+	defer m.Unlock()
+	ret := make(map[string]uint64, len(m.bindingHits))
+	for name, hits := range m.bindingHits {
+		ret[name] = hits
+	}
+	return ret
+}
+
+// Usage returns the granted requests since the MetricsRecorder was created
+func (m *MetricsRecorder) Usage() Usage {
+	m.Lock()
+	defer m.Unlock()
+	u := Usage{From: m.started, To: time.Now(), Hits: make(map[UsageKey]uint64, len(m.usage))}
+	for key, hits := range m.usage {
+		u.Hits[key] = hits
+	}
+	return u
+}
+
+// MetricsSnapshot is a copy of the counters of a MetricsRecorder
+type MetricsSnapshot struct {
+	// Decisions are ordered by verb, resource and outcome, allowed first
+	Decisions   []DecisionCount
+	BindingHits map[string]uint64
+
+	// Buckets are the upper bounds of the latency histogram in seconds and
+	// BucketCounts the cumulative number of decisions per bucket
+	Buckets      []float64
+	BucketCounts []uint64
+	LatencySum   float64
+	LatencyCount uint64
+
+	Roles        int
+	RoleBindings int
+}
+
+// DecisionCount represents the number of decisions with the same verb,
+// resource and outcome. The resource has the form
+// `resource[.group][/subresource]` like in Resource.String or is
+// nonResourceURL for non-resource URL requests.
+type DecisionCount struct {
+	Verb     string
+	Resource string
+	Allowed  bool
+	Count    uint64
+}
+
+// Snapshot returns a copy of the current counters
+func (m *MetricsRecorder) Snapshot() MetricsSnapshot {
+	m.Lock()
+	defer m.Unlock()
+
+	s := MetricsSnapshot{
+		Decisions:    make([]DecisionCount, 0, len(m.decisions)),
+		BindingHits:  make(map[string]uint64, len(m.bindingHits)),
+		Buckets:      append([]float64(nil), m.buckets...),
+		BucketCounts: append([]uint64(nil), m.bucketCounts...),
+		LatencySum:   m.latencySum,
+		LatencyCount: m.latencyCount,
+		Roles:        m.roles,
+		RoleBindings: m.rolebindings,
+	}
+	for labels, n := range m.decisions {
+		s.Decisions = append(s.Decisions, DecisionCount{Verb: labels.verb, Resource: labels.resource, Allowed: labels.allowed, Count: n})
+	}
+	sort.Slice(s.Decisions, func(i, j int) bool {
+		if s.Decisions[i].Verb != s.Decisions[j].Verb {
+			return s.Decisions[i].Verb < s.Decisions[j].Verb
+		}
+		if s.Decisions[i].Resource != s.Decisions[j].Resource {
+			return s.Decisions[i].Resource < s.Decisions[j].Resource
+		}
+		return s.Decisions[i].Allowed && !s.Decisions[j].Allowed
+	})
+	for name, hits := range m.bindingHits {
+		s.BindingHits[name] = hits
+	}
+	return s
+}
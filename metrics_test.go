@@ -0,0 +1,50 @@
+package rbac
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestMetricsRecorder tests the counters of a MetricsRecorder
+func TestMetricsRecorder(t *testing.T) {
+	a := createExtensiveAuthorizer()
+	m := NewMetricsRecorder()
+	a.SetMetrics(m)
+
+	subject := []Subject{{Name: "bofh", Kind: User}}
+	a.Eval("get", subject, Resource{Namespace: "linux", Resource: "nodes"})
+	a.Eval("get", subject, Resource{Namespace: "linux", Resource: "nodes"})
+	a.Eval("delete", subject, Resource{Namespace: "linux", Resource: "nodes"})
+	a.EvalNonResource("get", subject, "/healthz")
+	a.For(subject).Check("get", Resource{Namespace: "linux", Resource: "nodes"})
+	a.EvalBatch(subject, []VerbResource{{Verb: "list", Resource: Resource{Namespace: "linux", Resource: "nodes", APIGroup: "apps", Subresource: "states"}}})
+
+	hits := m.BindingHits()
+	if len(hits) != 1 || hits["linux-node-watchers"] != 3 {
+		t.Errorf("Unexpected binding hits %v", hits)
+	}
+
+	if err := a.SetRole(Role{Name: "empty", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"x"}}}}); err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	s := m.Snapshot()
+	expected := []DecisionCount{
+		{Verb: "delete", Resource: "nodes", Allowed: false, Count: 1},
+		{Verb: "get", Resource: "nodes", Allowed: true, Count: 3},
+		{Verb: "get", Resource: nonResourceLabel, Allowed: false, Count: 1},
+		{Verb: "list", Resource: "nodes.apps/states", Allowed: false, Count: 1},
+	}
+	if !reflect.DeepEqual(s.Decisions, expected) {
+		t.Errorf("Unexpected decisions %+v", s.Decisions)
+	}
+	if s.LatencyCount != 6 || s.Roles != 3 || s.RoleBindings != 3 || s.BindingHits["linux-node-watchers"] != 3 {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+
+	m.ObserveDecision(Result{Request: Request{Verb: "get"}}, time.Hour)
+	if n := m.Snapshot().BucketCounts[len(s.Buckets)-1]; n != 6 {
+		t.Errorf("Slow decision shouldn't be counted in the last bucket, got %d", n)
+	}
+}
@@ -0,0 +1,286 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Domain represents a finite set of requests that covers the distinctions a
+// policy makes. Wildcards of the rules are kept literally, so the resource `*`
+// represents a request for any resource.
+type Domain struct {
+	Subjects   []Subject
+	Verbs      []string
+	Namespaces []string
+	Resources  []Resource
+	Paths      []string
+}
+
+// PolicyDomain derives the Domain of one or more policies. It contains the
+// subjects of the RoleBindings, the verbs of the rules, the global scope and
+// all namespaces that are bound or registered, the resources of the rules
+// with and without their resource names and the non-resource URLs.
+func PolicyDomain(policies ...Policy) Domain {
+	subjects := map[Subject]bool{}
+	verbs := map[string]bool{}
+	namespaces := map[string]bool{"": true}
+	resources := map[string]Resource{}
+	paths := map[string]bool{}
+
+	for _, p := range policies {
+		for _, r := range p.Roles {
+			for _, rule := range r.Rules {
+				for _, v := range rule.Verbs {
+					verbs[v] = true
+				}
+				for _, path := range rule.NonResourceURLs {
+					paths[path] = true
+				}
+
+				groups := rule.APIGroups
+				if len(groups) == 0 {
+					groups = []string{""}
+				}
+				names := append([]string{""}, rule.ResourceNames...)
+				for _, group := range groups {
+					for _, res := range rule.Resources {
+						for _, name := range names {
+							r := Resource{APIGroup: group, Resource: res, ResourceName: name}
+							if i := strings.IndexByte(res, '/'); i >= 0 {
+								r.Resource, r.Subresource = res[:i], res[i+1:]
+							}
+							resources[r.String()] = r
+						}
+					}
+				}
+			}
+		}
+
+		for _, rb := range p.RoleBindings {
+			for _, s := range rb.Subjects {
+				subjects[s] = true
+			}
+			if rb.Namespace != "" {
+				namespaces[rb.Namespace] = true
+			}
+			for _, ns := range rb.Namespaces {
+				namespaces[ns] = true
+			}
+		}
+
+		for _, n := range p.Namespaces {
+			namespaces[n.Name] = true
+		}
+	}
+
+	var d Domain
+	for s := range subjects {
+		d.Subjects = append(d.Subjects, s)
+	}
+	for v := range verbs {
+		d.Verbs = append(d.Verbs, v)
+	}
+	for ns := range namespaces {
+		d.Namespaces = append(d.Namespaces, ns)
+	}
+	for _, r := range resources {
+		d.Resources = append(d.Resources, r)
+	}
+	for path := range paths {
+		d.Paths = append(d.Paths, path)
+	}
+
+	sort.Slice(d.Subjects, func(i, j int) bool { return subjectLess(d.Subjects[i], d.Subjects[j]) })
+	sort.Strings(d.Verbs)
+	sort.Strings(d.Namespaces)
+	sort.Slice(d.Resources, func(i, j int) bool { return resourceLess(d.Resources[i], d.Resources[j]) })
+	sort.Strings(d.Paths)
+	return d
+}
+
+// Permission represents an effective permission of a subject to apply a verb
+// to a resource or non-resource URL. It is attributed to the first RoleBinding
+// granting it without a condition like Eval does. Only if every granting rule
+// has a condition, it is attributed to the first of them and Condition is set
+// to the condition of the rule.
+type Permission struct {
+	Subject     Subject  `json:"subject"`
+	Verb        string   `json:"verb"`
+	Resource    Resource `json:"resource,omitempty"`
+	Path        string   `json:"path,omitempty"`
+	RoleBinding string   `json:"roleBinding"`
+	Role        string   `json:"role"`
+	Condition   string   `json:"condition,omitempty"`
+}
+
+func (p Permission) String() string {
+	requested := p.Resource.String()
+	if p.Path != "" {
+		requested = p.Path
+	}
+
+	s := p.Subject.String() + " " + p.Verb + " " + requested
+	if p.Condition != "" {
+		s += " if " + p.Condition
+	}
+	return s
+}
+
+// key identifies the permission without its attribution
+func (p Permission) key() string {
+	return p.Subject.String() + "\x00" + p.Verb + "\x00" + p.Resource.String() + "\x00" + p.Path + "\x00" + p.Condition
+}
+
+// EffectivePermissions evaluates every request of the Domain against a policy
+// for each subject on its own and returns the granted ones. Conditions are
+// assumed to be satisfied and RoleBindings to be valid at any time, so the
+// permissions represent what the policy can grant. The permissions are ordered
+// by subject, namespace, resource, path and verb.
+func EffectivePermissions(p Policy, d Domain) ([]Permission, error) {
+	return effectivePermissions(p, d, nil)
+}
+
+// effectivePermissions is EffectivePermissions with an optional namespace
+// hierarchy, see SetNamespaceParent
+func effectivePermissions(p Policy, d Domain, parent func(namespace string) string) ([]Permission, error) {
+	unconditional, _, err := permissionAuthorizer(p, false)
+	if err != nil {
+		return nil, err
+	}
+	a, conditions, err := permissionAuthorizer(p, true)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil {
+		unconditional.SetNamespaceParent(parent)
+		a.SetNamespaceParent(parent)
+	}
+
+	var items []VerbResource
+	for _, verb := range d.Verbs {
+		for _, ns := range d.Namespaces {
+			for _, res := range d.Resources {
+				res.Namespace = ns
+				items = append(items, VerbResource{Verb: verb, Resource: res})
+			}
+		}
+	}
+
+	// A grant without condition is preferred over a conditional one of an
+	// earlier rule, which would mask it
+	var ret []Permission
+	add := func(subject Subject, res, conditional Result) {
+		var condition string
+		if !res.Success {
+			if !conditional.Success {
+				return
+			}
+			res, condition = conditional, conditions[conditional.Role][conditional.Rule]
+		}
+		ret = append(ret, Permission{
+			Subject:     subject,
+			Verb:        res.Request.Verb,
+			Resource:    res.Request.Resource,
+			Path:        res.Request.Path,
+			RoleBinding: res.RoleBinding,
+			Role:        res.Role,
+			Condition:   condition,
+		})
+	}
+
+	for _, subject := range d.Subjects {
+		subjects := []Subject{subject}
+		conditional := a.EvalBatch(subjects, items)
+		for i, res := range unconditional.EvalBatch(subjects, items) {
+			add(subject, res, conditional[i])
+		}
+		for _, verb := range d.Verbs {
+			for _, path := range d.Paths {
+				add(subject, unconditional.EvalNonResource(verb, subjects, path), a.EvalNonResource(verb, subjects, path))
+			}
+		}
+	}
+
+	sortPermissions(ret)
+	return ret, nil
+}
+
+// permissionAuthorizer returns an Authorizer with the policy without conditions
+// and validity periods and the removed conditions of the rules by role. If
+// `conditional` is false, the rules with a condition are removed as well.
+func permissionAuthorizer(p Policy, conditional bool) (*Authorizer, map[string][]string, error) {
+	conditions := map[string][]string{}
+	unconditional := Policy{
+		Roles:        make([]Role, len(p.Roles)),
+		RoleBindings: make([]RoleBinding, len(p.RoleBindings)),
+		Namespaces:   p.Namespaces,
+	}
+	for i, r := range p.Roles {
+		conditions[r.Name] = make([]string, len(r.Rules))
+		unconditional.Roles[i] = Role{Name: r.Name, Rules: make([]Rule, 0, len(r.Rules))}
+		for j, rule := range r.Rules {
+			conditions[r.Name][j] = rule.Condition
+			if rule.Condition != "" && !conditional {
+				continue
+			}
+			rule.Condition = ""
+			unconditional.Roles[i].Rules = append(unconditional.Roles[i].Rules, rule)
+		}
+	}
+	for i, rb := range p.RoleBindings {
+		rb.NotBefore, rb.NotAfter = time.Time{}, time.Time{}
+		unconditional.RoleBindings[i] = rb
+	}
+
+	a := New()
+	if err := a.SetPolicy(unconditional); err != nil {
+		return nil, nil, err
+	}
+	return a, conditions, nil
+}
+
+// sortPermissions orders permissions by subject, namespace, resource, path and verb
+func sortPermissions(ps []Permission) {
+	sort.Slice(ps, func(i, j int) bool {
+		pi, pj := ps[i], ps[j]
+		if pi.Subject != pj.Subject {
+			return subjectLess(pi.Subject, pj.Subject)
+		}
+		if resourceLess(pi.Resource, pj.Resource) || resourceLess(pj.Resource, pi.Resource) {
+			return resourceLess(pi.Resource, pj.Resource)
+		}
+		if pi.Path != pj.Path {
+			return pi.Path < pj.Path
+		}
+		if pi.Verb != pj.Verb {
+			return pi.Verb < pj.Verb
+		}
+		return pi.Condition < pj.Condition
+	})
+}
+
+// subjectLess orders subjects by kind and name
+func subjectLess(a, b Subject) bool {
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	return a.Name < b.Name
+}
+
+// resourceLess orders resources by namespace, API group, resource,
+// subresource and resource name
+func resourceLess(a, b Resource) bool {
+	switch {
+	case a.Namespace != b.Namespace:
+		return a.Namespace < b.Namespace
+	case a.APIGroup != b.APIGroup:
+		return a.APIGroup < b.APIGroup
+	case a.Resource != b.Resource:
+		return a.Resource < b.Resource
+	case a.Subresource != b.Subresource:
+		return a.Subresource < b.Subresource
+	default:
+		return a.ResourceName < b.ResourceName
+	}
+}
@@ -0,0 +1,96 @@
+package rbac
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Policy represents all Roles, RoleBindings and Namespaces of an Authorizer.
+// It can be encoded as a List document in the format of example.yaml.
+type Policy struct {
+	Roles        []Role
+	RoleBindings []RoleBinding
+	Namespaces   []Namespace
+}
+
+// Policy returns the current policy of the Authorizer ordered by names
+func (a *Authorizer) Policy() Policy {
+	a.RLock()
+	defer a.RUnlock()
+
+	p := Policy{
+		Roles:        make([]Role, 0, len(a.roles)),
+		RoleBindings: make([]RoleBinding, 0, len(a.rolebindings)),
+		Namespaces:   make([]Namespace, 0, len(a.namespaces)),
+	}
+	for _, r := range a.roles {
+		p.Roles = append(p.Roles, r)
+	}
+	for _, name := range a.bindingOrder {
+		p.RoleBindings = append(p.RoleBindings, a.rolebindings[name])
+	}
+	for _, n := range a.namespaces {
+		p.Namespaces = append(p.Namespaces, n)
+	}
+
+	sort.Slice(p.Roles, func(i, j int) bool { return p.Roles[i].Name < p.Roles[j].Name })
+	sort.Slice(p.Namespaces, func(i, j int) bool { return p.Namespaces[i].Name < p.Namespaces[j].Name })
+	return p
+}
+
+// SetPolicy validates a policy and replaces all Roles, RoleBindings and
+// Namespaces of the Authorizer with it at once. If the policy is invalid or
+// contains duplicate names, the Authorizer is left unchanged.
+func (a *Authorizer) SetPolicy(p Policy) error {
+	roles := make(map[string]Role, len(p.Roles))
+	conditions := make(map[string][]*condition, len(p.Roles))
+	for _, r := range p.Roles {
+		if _, ok := roles[r.Name]; ok {
+			return fmt.Errorf("duplicate Role %q", r.Name)
+		}
+
+		cond, err := compileRole(r)
+		if err != nil {
+			return fmt.Errorf("Role %q: %w", r.Name, err)
+		}
+		roles[r.Name] = r
+		conditions[r.Name] = cond
+	}
+
+	rolebindings := make(map[string]RoleBinding, len(p.RoleBindings))
+	order := make([]string, 0, len(p.RoleBindings))
+	for _, r := range p.RoleBindings {
+		if _, ok := rolebindings[r.Name]; ok {
+			return fmt.Errorf("duplicate RoleBinding %q", r.Name)
+		}
+
+		if err := validateRoleBinding(r); err != nil {
+			return fmt.Errorf("RoleBinding %q: %w", r.Name, err)
+		}
+		rolebindings[r.Name] = r
+		order = append(order, r.Name)
+	}
+	sort.Strings(order)
+
+	namespaces := make(map[string]Namespace, len(p.Namespaces))
+	for _, n := range p.Namespaces {
+		if _, ok := namespaces[n.Name]; ok {
+			return fmt.Errorf("duplicate Namespace %q", n.Name)
+		}
+
+		if err := validateNamespace(n); err != nil {
+			return fmt.Errorf("Namespace %q: %w", n.Name, err)
+		}
+		namespaces[n.Name] = n
+	}
+
+	a.Lock()
+	a.roles = roles
+	a.conditions = conditions
+	a.rolebindings = rolebindings
+	a.bindingOrder = order
+	a.namespaces = namespaces
+	a.changed()
+	a.Unlock()
+	return nil
+}
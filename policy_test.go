@@ -0,0 +1,190 @@
+package rbac
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPolicyJSON tests that a policy survives the export and import as JSON
+func TestPolicyJSON(t *testing.T) {
+	a := createExtensiveAuthorizer()
+	if err := a.SetNamespace(Namespace{Name: "linux", Labels: map[string]string{"os": "unix"}}); err != nil {
+		t.Fatalf("SetNamespace failed with %q", err)
+	}
+	err := a.SetRoleBinding(RoleBinding{
+		Name:              "temporary",
+		Role:              "readonly",
+		Namespaces:        []string{"linux", "windows"},
+		NamespaceSelector: map[string]string{"os": "unix"},
+		Subjects:          []Subject{{Name: "bofh", Kind: User}},
+		NotBefore:         time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC),
+		NotAfter:          time.Date(2020, 3, 4, 12, 0, 0, 0, time.UTC),
+		Approvals: []Approval{{
+			Request:   "1",
+			Requester: Subject{Name: "bofh", Kind: User},
+			Approver:  Subject{Name: "boss", Kind: User},
+			Time:      time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := a.ExportJSON(buf); err != nil {
+		t.Fatalf("ExportJSON failed with %q", err)
+	}
+	for _, s := range []string{`"kind": "List"`, `"roleRef": {`, `"kind": "ServiceAccount"`, `"resourceNames": [`} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Exported JSON should contain %s:\n%s", s, buf)
+		}
+	}
+
+	b := New()
+	if err := b.ImportJSON(buf); err != nil {
+		t.Fatalf("ImportJSON failed with %q", err)
+	}
+	if !reflect.DeepEqual(a.Policy(), b.Policy()) {
+		t.Errorf("Imported policy differs:\n%+v\n%+v", a.Policy(), b.Policy())
+	}
+
+	// Single objects are accepted as well
+	single := `{"kind": "Role", "metadata": {"name": "r"}, "rules": [{"verbs": ["get"], "resources": ["nodes"]}]}
+{"kind": "RoleBinding", "metadata": {"name": "rb"}, "roleRef": {"name": "r"}, "subjects": [{"kind": "Group", "name": "g"}]}`
+	if err := b.ImportJSON(strings.NewReader(single)); err != nil {
+		t.Fatalf("ImportJSON failed with %q", err)
+	}
+	if res := b.Eval("get", []Subject{{Name: "g", Kind: Group}}, Resource{Resource: "nodes"}); !res.Success {
+		t.Errorf("Imported policy should validate, but didn't: %s", res)
+	}
+
+	for _, invalid := range []string{
+		`{"kind": "Pod"}`,
+		`{"kind": "RoleBinding", "metadata": {"name": "rb"}, "roleRef": {"name": "r"}, "subjects": [{"kind": "Robot", "name": "g"}]}`,
+		`{"kind": "Role", "metadata": {"name": "r"}, "rules": [{"verbs": ["get"]}]}`,
+		`{"kind": "List", "items": [{"kind": "Namespace", "metadata": {"name": "a"}}, {"kind": "Namespace", "metadata": {"name": "a"}}]}`,
+	} {
+		if err := b.ImportJSON(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ImportJSON should fail for %s", invalid)
+		}
+	}
+	if b.GetRole("r").Name != "r" {
+		t.Error("Failed imports should leave the policy unchanged")
+	}
+
+	// Roles without rules must encode the same, whether Rules is nil or empty
+	var exports []string
+	for _, rules := range [][]Rule{nil, {}} {
+		c := New()
+		if err := c.SetRole(Role{Name: "empty", Rules: rules}); err != nil {
+			t.Fatalf("SetRole failed with %q", err)
+		}
+		buf := &bytes.Buffer{}
+		if err := c.ExportJSON(buf); err != nil {
+			t.Fatalf("ExportJSON failed with %q", err)
+		}
+		exports = append(exports, buf.String())
+	}
+	if exports[0] != exports[1] {
+		t.Errorf("Roles without rules encode differently:\n%s\n%s", exports[0], exports[1])
+	}
+
+	// Subjects decode to what was encoded and invalid kinds aren't encoded
+	for _, s := range []Subject{{Name: "bofh", Kind: User}, {Name: "nobody"}} {
+		enc, err := json.Marshal(s)
+		if err != nil {
+			t.Fatalf("Marshalling %s failed with %q", s, err)
+		}
+		var dec Subject
+		if err := json.Unmarshal(enc, &dec); err != nil || dec != s {
+			t.Errorf("Decoding %s returned %s, %v", enc, dec, err)
+		}
+	}
+	if _, err := json.Marshal(Subject{Name: "robot", Kind: 7}); err == nil {
+		t.Error("Subjects with invalid kinds should not be encoded")
+	}
+}
+
+// TestPolicyYAML tests loading example.yaml and that the YAML export can be
+// loaded again without losing anything
+func TestPolicyYAML(t *testing.T) {
+	f, err := os.Open("example.yaml")
+	if err != nil {
+		t.Fatalf("Opening example.yaml failed with %q", err)
+	}
+	defer f.Close()
+
+	a := New()
+	if err := a.LoadYAML(f); err != nil {
+		t.Fatalf("LoadYAML failed with %q", err)
+	}
+	if !reflect.DeepEqual(a.Policy(), createExtensiveAuthorizer().Policy()) {
+		t.Fatalf("example.yaml should equal the extensive test data:\n%+v", a.Policy())
+	}
+
+	err = a.SetRole(Role{Name: "owner", Rules: []Rule{{
+		Verbs:     []string{"update"},
+		APIGroups: []string{"docs"},
+		Resources: []string{"documents"},
+		Condition: `attr.owner == subject.name && verb in ["update"]`,
+	}, {
+		Verbs:           []string{"get"},
+		NonResourceURLs: []string{"/healthz"},
+	}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{
+		Name:              "owners",
+		Role:              "owner",
+		Namespaces:        []string{"linux"},
+		NamespaceSelector: map[string]string{"os": "unix"},
+		Subjects:          []Subject{{Name: "bofh", Kind: User}},
+		NotAfter:          time.Date(2020, 3, 4, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+	if err := a.SetNamespace(Namespace{Name: "linux", Labels: map[string]string{"os": "unix"}}); err != nil {
+		t.Fatalf("SetNamespace failed with %q", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := a.WriteYAML(buf); err != nil {
+		t.Fatalf("WriteYAML failed with %q", err)
+	}
+	out := buf.String()
+
+	b := New()
+	if err := b.LoadYAML(buf); err != nil {
+		t.Fatalf("LoadYAML failed with %q:\n%s", err, out)
+	}
+	if !reflect.DeepEqual(a.Policy(), b.Policy()) {
+		t.Errorf("Loaded policy differs:\n%s", out)
+	}
+
+	buf.Reset()
+	if err := b.WriteYAML(buf); err != nil {
+		t.Fatalf("WriteYAML failed with %q", err)
+	}
+	if buf.String() != out {
+		t.Errorf("Export isn't deterministic:\n%s\n%s", out, buf)
+	}
+
+	if err := b.LoadYAML(strings.NewReader("kind: Pod\n")); err == nil {
+		t.Error("LoadYAML should fail for unknown kinds")
+	}
+
+	buf.Reset()
+	if err := New().WriteYAML(buf); err != nil {
+		t.Errorf("WriteYAML of an empty policy failed with %q", err)
+	}
+	if err := b.LoadYAML(buf); err != nil || len(b.Policy().Roles) != 0 {
+		t.Errorf("Loading an empty export should clear the policy, failed with %v", err)
+	}
+}
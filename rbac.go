@@ -1,9 +1,13 @@
 package rbac
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Authorizer provides a RBAC authorizer. It must be created by calling New()
@@ -11,6 +15,29 @@ type Authorizer struct {
 	sync.RWMutex
 	roles        map[string]Role
 	rolebindings map[string]RoleBinding
+	bindingOrder []string // names of the rolebindings in evaluation order
+	namespaces   map[string]Namespace
+	conditions   map[string][]*condition // compiled rule conditions per role
+	clock        func() time.Time
+	parent       func(namespace string) string
+	onEvent      func(Event)
+	resolver     SubjectResolver
+	audit        AuditSink
+	generation   uint64 // incremented on every policy change
+	cache        *decisionCache
+	metrics      Metrics
+}
+
+// SubjectResolver expands the subjects of a request before it is evaluated,
+// for example by adding the groups of a user from an external directory.
+type SubjectResolver interface {
+	ResolveSubjects(ctx context.Context, subjects []Subject) ([]Subject, error)
+}
+
+// AuditSink receives every evaluated request together with its result and the
+// time of the decision according to the clock of the Authorizer
+type AuditSink interface {
+	Audit(ctx context.Context, req Request, res Result, at time.Time) error
 }
 
 // New instantiates a RBAC authorizer
@@ -18,39 +45,149 @@ func New() *Authorizer {
 	return &Authorizer{
 		roles:        map[string]Role{},
 		rolebindings: map[string]RoleBinding{},
+		namespaces:   map[string]Namespace{},
+		conditions:   map[string][]*condition{},
+		clock:        time.Now,
+	}
+}
+
+// SetClock replaces the function used to get the current time, which is
+// time.Now by default. It allows to evaluate time based rules deterministically.
+func (a *Authorizer) SetClock(clock func() time.Time) {
+	a.Lock()
+	a.clock = clock
+	a.changed()
+	a.Unlock()
+}
+
+// SetSubjectResolver registers a SubjectResolver that is called for every
+// evaluated request. Passing nil removes the resolver.
+func (a *Authorizer) SetSubjectResolver(r SubjectResolver) {
+	a.Lock()
+	a.resolver = r
+	a.Unlock()
+}
+
+// SetAuditSink registers an AuditSink that is called for every evaluated
+// request. Passing nil removes the sink.
+func (a *Authorizer) SetAuditSink(s AuditSink) {
+	a.Lock()
+	a.audit = s
+	a.Unlock()
+}
+
+// changed must be called with the write lock held after every change that
+// might affect the evaluation of requests
+func (a *Authorizer) changed() {
+	a.generation++
+	if a.cache != nil {
+		a.cache.reset(a.generation)
+	}
+	if a.metrics != nil {
+		a.metrics.ObservePolicy(len(a.roles), len(a.rolebindings))
+	}
+}
+
+// now returns the current time according to the clock of the Authorizer
+func (a *Authorizer) now() time.Time {
+	a.RLock()
+	defer a.RUnlock()
+	return a.clock()
+}
+
+// SetNamespaceParent configures a namespace hierarchy. The function `parent`
+// must return the parent of a namespace or an empty string for top level
+// namespaces. RoleBindings of a namespace then also apply to all of its
+// descendants. Passing nil disables the hierarchy.
+func (a *Authorizer) SetNamespaceParent(parent func(namespace string) string) {
+	a.Lock()
+	a.parent = parent
+	a.changed()
+	a.Unlock()
+}
+
+// PathNamespaceParent returns a parent function for SetNamespaceParent that
+// treats namespaces as paths separated by `sep`, so `org-a` is the parent of
+// `org-a/team-1` if `sep` is `/`.
+func PathNamespaceParent(sep string) func(namespace string) string {
+	return func(namespace string) string {
+		i := strings.LastIndex(namespace, sep)
+		if i < 0 {
+			return ""
+		}
+		return namespace[:i]
 	}
 }
 
 // SetRole validates a role and adds it to the Authorizer
 func (a *Authorizer) SetRole(r Role) error {
+	conditions, err := compileRole(r)
+	if err != nil {
+		return err
+	}
+
+	a.Lock()
+	a.roles[r.Name] = r
+	a.conditions[r.Name] = conditions
+	a.changed()
+	a.Unlock()
+	return nil
+}
+
+// compileRole validates a role and returns the compiled conditions of its rules
+func compileRole(r Role) ([]*condition, error) {
 	if r.Name == "" {
-		return errors.New("Role needs to have a name")
+		return nil, errors.New("Role needs to have a name")
 	}
 
-	for _, rule := range r.Rules {
+	conditions := make([]*condition, len(r.Rules))
+	for i, rule := range r.Rules {
 		if len(rule.Verbs) == 0 {
-			return errors.New("Every rule needs at least a verb")
+			return nil, errors.New("Every rule needs at least a verb")
 		}
 
-		if len(rule.Resources) == 0 {
-			return errors.New("Every rule needs at least a resource")
+		if len(rule.Resources) == 0 && len(rule.NonResourceURLs) == 0 {
+			return nil, errors.New("Every rule needs at least a resource or a non-resource URL")
 		}
 
 		for _, v := range rule.Verbs {
 			if v == "" {
-				return errors.New("Every rule needs to have valid verbs")
+				return nil, errors.New("Every rule needs to have valid verbs")
+			}
+		}
+
+		if rule.Condition != "" {
+			cond, err := compileCondition(rule.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition %q: %s", rule.Condition, err)
 			}
+			conditions[i] = cond
 		}
 	}
+	return conditions, nil
+}
+
+// SetRoleBinding validates a role binding and adds it to the Authorizer
+func (a *Authorizer) SetRoleBinding(r RoleBinding) error {
+	if err := validateRoleBinding(r); err != nil {
+		return err
+	}
 
 	a.Lock()
-	a.roles[r.Name] = r
+	if _, ok := a.rolebindings[r.Name]; !ok {
+		i := sort.SearchStrings(a.bindingOrder, r.Name)
+		a.bindingOrder = append(a.bindingOrder, "")
+		copy(a.bindingOrder[i+1:], a.bindingOrder[i:])
+		a.bindingOrder[i] = r.Name
+	}
+	a.rolebindings[r.Name] = r
+	a.changed()
 	a.Unlock()
 	return nil
 }
 
-// SetRoleBinding validates a role binding and adds it to the Authorizer
-func (a *Authorizer) SetRoleBinding(r RoleBinding) error {
+// validateRoleBinding validates a role binding
+func validateRoleBinding(r RoleBinding) error {
 	if r.Name == "" {
 		return errors.New("RoleBinding needs to have a name")
 	}
@@ -68,31 +205,89 @@ func (a *Authorizer) SetRoleBinding(r RoleBinding) error {
 			return errors.New("every Subject needs to have a name")
 		}
 
-		if subject.Kind.String() == "" {
+		if !subject.Kind.valid() {
 			return errors.New("every Subject needs to have a valid type")
 		}
 	}
 
+	for _, ns := range r.Namespaces {
+		if ns == "" {
+			return errors.New("RoleBinding namespaces must not be empty")
+		}
+	}
+
+	if !r.NotBefore.IsZero() && !r.NotAfter.IsZero() && !r.NotBefore.Before(r.NotAfter) {
+		return errors.New("RoleBinding needs to have NotBefore before NotAfter")
+	}
+	return nil
+}
+
+// SetNamespace validates the metadata of a namespace and adds it to the Authorizer.
+// The labels of registered namespaces are matched by RoleBinding namespace selectors.
+func (a *Authorizer) SetNamespace(n Namespace) error {
+	if err := validateNamespace(n); err != nil {
+		return err
+	}
+
 	a.Lock()
-	a.rolebindings[r.Name] = r
+	a.namespaces[n.Name] = n
+	a.changed()
 	a.Unlock()
 	return nil
 }
 
+// validateNamespace validates the metadata of a namespace
+func validateNamespace(n Namespace) error {
+	if n.Name == "" {
+		return errors.New("Namespace needs to have a name")
+	}
+	return nil
+}
+
+// DeleteNamespace removes the metadata of a named namespace from the Authorizer
+func (a *Authorizer) DeleteNamespace(name string) {
+	a.Lock()
+	delete(a.namespaces, name)
+	a.changed()
+	a.Unlock()
+}
+
+// GetNamespace returns the metadata of the named namespace registered in the Authorizer
+func (a *Authorizer) GetNamespace(name string) Namespace {
+	a.RLock()
+	n := a.namespaces[name]
+	a.RUnlock()
+	return n
+}
+
 // DeleteRole removes a named role from the Authorizer
 func (a *Authorizer) DeleteRole(name string) {
 	a.Lock()
 	delete(a.roles, name)
+	delete(a.conditions, name)
+	a.changed()
 	a.Unlock()
 }
 
 // DeleteRoleBinding removes a named role binding from the Authorizer
 func (a *Authorizer) DeleteRoleBinding(name string) {
 	a.Lock()
-	delete(a.rolebindings, name)
+	a.deleteRoleBinding(name)
+	a.changed()
 	a.Unlock()
 }
 
+// deleteRoleBinding removes a role binding, the caller must hold the write lock
+func (a *Authorizer) deleteRoleBinding(name string) {
+	if _, ok := a.rolebindings[name]; !ok {
+		return
+	}
+
+	delete(a.rolebindings, name)
+	i := sort.SearchStrings(a.bindingOrder, name)
+	a.bindingOrder = append(a.bindingOrder[:i], a.bindingOrder[i+1:]...)
+}
+
 // GetRole returns the named role registered in the Authorizer
 func (a *Authorizer) GetRole(name string) Role {
 	a.RLock()
@@ -113,8 +308,16 @@ func (a *Authorizer) GetRoleBinding(name string) RoleBinding {
 // succeeded.
 func (r Result) String() string {
 	if !r.Success {
-		return fmt.Sprintf("authorization failed for %s requesting %s %s",
-			r.RequestingSubject, r.RequestedVerb, r.RequestedResource)
+		requested := r.Request.Resource.String()
+		if r.Request.Path != "" {
+			requested = r.Request.Path
+		}
+		msg := fmt.Sprintf("authorization failed for %s requesting %s %s",
+			r.Request.Subjects, r.Request.Verb, requested)
+		if len(r.ConditionFailures) > 0 {
+			msg += ": " + strings.Join(r.ConditionFailures, "; ")
+		}
+		return msg
 	}
 
 	return fmt.Sprintf("authorization succeeded for %s %q as %s using %s", r.SubjectType, r.Subject, r.Role, r.RoleBinding)
@@ -122,64 +325,383 @@ func (r Result) String() string {
 
 // Eval evaluates the RBAC rules from the Authorizer according to a request and returns the authorization result.
 // The request is represented by a verb, the requesting subject and the requested resource.
+// RoleBindings are evaluated in the order of their names and the first one
+// granting the request is reported in the result.
+// Errors of the SubjectResolver or AuditSink result in a denied request, use
+// EvalContext to handle them.
 func (a *Authorizer) Eval(verb string, subject []Subject, resource Resource) Result {
+	res, _ := a.EvalContext(context.Background(), Request{Verb: verb, Subjects: subject, Resource: resource})
+	return res
+}
+
+// EvalNonResource evaluates the RBAC rules from the Authorizer for a request to
+// a path that doesn't represent a resource, such as `/healthz` or `/metrics`.
+// Only rules with matching non-resource URLs of global RoleBindings apply. An
+// empty path is denied.
+func (a *Authorizer) EvalNonResource(verb string, subject []Subject, path string) Result {
+	if path == "" {
+		return Request{Verb: verb, Subjects: subject}.result()
+	}
+	res, _ := a.EvalContext(context.Background(), Request{Verb: verb, Subjects: subject, Path: path})
+	return res
+}
+
+// EvalContext evaluates the RBAC rules from the Authorizer according to a
+// request and returns the authorization result. The context is passed to the
+// SubjectResolver and AuditSink. If the context is done or one of them fails,
+// the request is denied and the error is returned.
+func (a *Authorizer) EvalContext(ctx context.Context, req Request) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return req.result(), err
+	}
+
 	a.RLock()
+	resolver, sink, cache, generation, metrics := a.resolver, a.audit, a.cache, a.generation, a.metrics
+	a.RUnlock()
+
+	if resolver != nil {
+		subjects, err := resolver.ResolveSubjects(ctx, req.Subjects)
+		if err != nil {
+			return req.result(), fmt.Errorf("resolving subjects failed: %w", err)
+		}
+		req.Subjects = subjects
+
+		if err := ctx.Err(); err != nil {
+			return req.result(), err
+		}
+	}
 
 	var res Result
-	var r bool
-	for rb := range a.rolebindings {
-		// Check if scope matches rolebinding
-		scopeOk := sMatchOrEmpty(a.rolebindings[rb].Namespace, resource.Namespace)
+	start := time.Now()
+	if cache != nil {
+		res = a.evalCached(cache, generation, req)
+	} else {
+		res = a.evalRequest(req)
+	}
+	observe(metrics, res, start)
+
+	if sink != nil {
+		if err := sink.Audit(ctx, req, res, a.now()); err != nil {
+			return req.result(), fmt.Errorf("auditing failed: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
+// evalRequest evaluates a request against the RoleBindings without calling
+// any pluggable component
+func (a *Authorizer) evalRequest(req Request) Result {
+	a.RLock()
+	defer a.RUnlock()
+
+	var now time.Time
+	return a.evalGrants(req, a.grants(req.Subjects, &now), &now)
+}
+
+// grant represents a RoleBinding that applies to the requesting subjects
+// together with its role
+type grant struct {
+	binding    RoleBinding
+	subject    Subject   // subject the grant is attributed to
+	subjects   []Subject // all matching subjects, for the conditions
+	role       Role
+	conditions []*condition
+}
+
+// grants returns the RoleBindings that are currently valid, have an existing
+// role and apply to one of the subjects. They are returned ordered by name so
+// the first granting RoleBinding is deterministic. If `now` is nil, the
+// validity period of the RoleBindings isn't checked. The caller must hold the
+// read lock.
+func (a *Authorizer) grants(subject []Subject, now *time.Time) []grant {
+	var ret []grant
+	for _, rb := range a.bindingOrder {
+		// Check if rolebinding is valid at this time
+		if now != nil && a.rolebindings[rb].timeBounded() {
+			if !a.rolebindings[rb].validAt(a.lazyNow(now)) {
+				continue
+			}
+		}
 
 		// Check if subject matches rolebinding
-		var subjectOk bool
-		var subjectApplied Subject
-		for _, reqSubject := range subject {
-			for _, subj := range a.rolebindings[rb].Subjects {
-				subjectValidated := (subj.Name == reqSubject.Name && subj.Kind == reqSubject.Kind)
-				subjectOk = subjectOk || subjectValidated
-				if subjectValidated {
-					subjectApplied = subj
-				}
+		subjects := matchAllSubjects(a.rolebindings[rb].Subjects, subject)
+		if len(subjects) == 0 {
+			continue
+		}
+
+		role, ok := a.roles[a.rolebindings[rb].Role]
+		if !ok {
+			continue
+		}
+
+		ret = append(ret, grant{
+			binding:    a.rolebindings[rb],
+			subject:    subjects[len(subjects)-1],
+			subjects:   subjects,
+			role:       role,
+			conditions: a.conditions[role.Name],
+		})
+	}
+	return ret
+}
+
+// evalGrants evaluates a request against the grants of its subjects. A grant
+// succeeds if its RoleBinding applies to the namespace and if the request and
+// the condition match a rule of its role. The caller must hold the read lock.
+func (a *Authorizer) evalGrants(req Request, grants []grant, now *time.Time) Result {
+	env := condEnv{verb: req.Verb, resource: req.Resource, path: req.Path, extra: req.Extra}
+	if req.Path != "" {
+		env.resource = Resource{}
+	}
+	ruleOk := ruleMatcher(req)
+
+	res := req.result()
+	ancestors := a.ancestors(env.resource.Namespace)
+	for _, g := range grants {
+		// Check if scope matches rolebinding
+		namespace, scopeOk := a.matchScope(g.binding, env.resource.Namespace, ancestors)
+		if !scopeOk {
+			continue
+		}
+
+		// Check if a rule matches the resource and its condition, if any
+		for i, rule := range g.role.Rules {
+			if !ruleOk(rule) {
+				continue
+			}
+			subject, condOk := a.checkCondition(g, i, &env, now, &res)
+			if !condOk {
+				continue
+			}
+
+			return g.granted(res, namespace, i, subject)
+		}
+	}
+
+	return res
+}
+
+// ruleMatcher returns a function that returns true if a rule matches the
+// request, ignoring its condition
+func ruleMatcher(req Request) func(Rule) bool {
+	verb, resource := req.Verb, req.Resource
+	if req.Path != "" {
+		return func(rule Rule) bool {
+			return nonResourceURLContains(rule.NonResourceURLs, req.Path) && sContains(rule.Verbs, verb, false)
+		}
+	}
+
+	requestedResource := resource.path()
+	return func(rule Rule) bool {
+		ruleAPIGroupsOk := apiGroupContains(rule.APIGroups, resource.APIGroup)
+		ruleRessourcesOk := resourceContains(rule.Resources, requestedResource)
+		ruleResourceNamesOk := sContains(rule.ResourceNames, resource.ResourceName, true)
+		ruleVerbsOk := sContains(rule.Verbs, verb, false)
+		return ruleAPIGroupsOk && ruleRessourcesOk && ruleResourceNamesOk && ruleVerbsOk
+	}
+}
+
+// checkCondition returns the subject rule `i` of the grant applies to and
+// true if the rule has no condition or if its condition is satisfied for one
+// of the matching subjects. The subjects are tried from the last to the first,
+// so the grant is attributed like one without a condition where possible.
+// Otherwise the reasons are added to the condition failures of `res`. The
+// caller must hold the read lock.
+func (a *Authorizer) checkCondition(g grant, i int, env *condEnv, now *time.Time, res *Result) (Subject, bool) {
+	cond := g.conditions[i]
+	if cond == nil {
+		return g.subject, true
+	}
+
+	env.now = a.lazyNow(now)
+	for j := len(g.subjects) - 1; j >= 0; j-- {
+		env.subject = g.subjects[j]
+		var as string
+		if len(g.subjects) > 1 {
+			as = " as " + env.subject.String()
+		}
+
+		condOk, err := cond.eval(env)
+		if err != nil {
+			res.ConditionFailures = append(res.ConditionFailures, fmt.Sprintf("rule %d of role %s using %s%s: condition %q failed: %s",
+				i, g.role.Name, g.binding.Name, as, cond.src, err))
+			continue
+		}
+		if !condOk {
+			res.ConditionFailures = append(res.ConditionFailures, fmt.Sprintf("rule %d of role %s using %s%s: condition %q not satisfied",
+				i, g.role.Name, g.binding.Name, as, cond.src))
+			continue
+		}
+		return env.subject, true
+	}
+	return Subject{}, false
+}
+
+// granted returns `res` as a successful Result attributed to rule `rule` of
+// the grant and to the subject, which applied at the given namespace
+func (g grant) granted(res Result, namespace string, rule int, subject Subject) Result {
+	res.Success = true
+	res.RoleBinding = g.binding.Name
+	res.Role = g.role.Name
+	res.Rule = rule
+	res.Subject = subject.Name
+	res.SubjectType = subject.Kind
+	res.Namespace = namespace
+	res.Expires = g.binding.NotAfter
+	res.ConditionFailures = nil
+	return res
+}
+
+// lazyNow returns `now` and sets it from the clock of the Authorizer first if
+// it is zero. The caller must hold the read lock.
+func (a *Authorizer) lazyNow(now *time.Time) time.Time {
+	if now.IsZero() {
+		*now = a.clock()
+	}
+	return *now
+}
+
+// maxNamespaceDepth limits the number of ancestors of a namespace to protect
+// against cycles in the namespace hierarchy
+const maxNamespaceDepth = 64
+
+// ancestors returns the parent, grandparent and so on of a namespace if a
+// namespace hierarchy is configured.
+func (a *Authorizer) ancestors(namespace string) []string {
+	if a.parent == nil || namespace == "" {
+		return nil
+	}
+
+	var ret []string
+	for p := a.parent(namespace); p != "" && p != namespace && len(ret) < maxNamespaceDepth; p = a.parent(p) {
+		ret = append(ret, p)
+		namespace = p
+	}
+	return ret
+}
+
+// matchScope returns true if a RoleBinding applies to a namespace or one of its
+// ancestors and returns the namespace through which it applies. RoleBindings
+// without any namespace, namespace list or selector apply globally.
+func (a *Authorizer) matchScope(rb RoleBinding, namespace string, ancestors []string) (string, bool) {
+	if rb.Namespace == "" && len(rb.Namespaces) == 0 && len(rb.NamespaceSelector) == 0 {
+		return "", true
+	}
+
+	if namespace == "" {
+		return "", false
+	}
+
+	for i := -1; i < len(ancestors); i++ {
+		ns := namespace
+		if i >= 0 {
+			ns = ancestors[i]
+		}
+
+		if rb.Namespace == ns || sContains(rb.Namespaces, ns, false) {
+			return ns, true
+		}
+
+		if len(rb.NamespaceSelector) > 0 {
+			if meta, ok := a.namespaces[ns]; ok && matchLabels(rb.NamespaceSelector, meta.Labels) {
+				return ns, true
 			}
 		}
+	}
+	return "", false
+}
+
+// matchLabels returns true if all labels of `selector` are contained in `labels`
+func matchLabels(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if l, ok := labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	return true
+}
 
-		// Check if a rule matches the resource
-		if role, ok := a.roles[a.rolebindings[rb].Role]; ok {
-			var roleOk bool
-			for _, rule := range role.Rules {
-				ruleRessourcesOk := sContains(rule.Resources, resource.Resource, false)
-				ruleResourceNamesOk := sContains(rule.ResourceNames, resource.ResourceName, true)
-				ruleVerbsOk := sContains(rule.Verbs, verb, false)
-				roleOk = roleOk || (ruleRessourcesOk && ruleResourceNamesOk && ruleVerbsOk)
+// matchSubjects returns the subject of a role binding that matches one of the
+// requesting subjects and if such a subject was found.
+func matchSubjects(bindingSubjects, reqSubjects []Subject) (Subject, bool) {
+	var subjectOk bool
+	var subjectApplied Subject
+	for _, reqSubject := range reqSubjects {
+		for _, subj := range bindingSubjects {
+			subjectValidated := (subj.Name == reqSubject.Name && subj.Kind == reqSubject.Kind)
+			subjectOk = subjectOk || subjectValidated
+			if subjectValidated {
+				subjectApplied = subj
 			}
+		}
+	}
+	return subjectApplied, subjectOk
+}
 
-			// Check if everything succeeded so we can stop here
-			r = (scopeOk && subjectOk && roleOk)
-			if r {
-				res = Result{
-					Success:     r,
-					RoleBinding: a.rolebindings[rb].Name,
-					Role:        role.Name,
-					Subject:     subjectApplied.Name,
-					SubjectType: subjectApplied.Kind,
-				}
-				break
+// matchAllSubjects returns the subjects of a role binding that match one of
+// the requesting subjects, in the order of the requesting subjects
+func matchAllSubjects(bindingSubjects, reqSubjects []Subject) []Subject {
+	var ret []Subject
+	for _, reqSubject := range reqSubjects {
+		for _, subj := range bindingSubjects {
+			if subj.Name == reqSubject.Name && subj.Kind == reqSubject.Kind {
+				ret = append(ret, subj)
 			}
 		}
 	}
-	a.RUnlock()
+	return ret
+}
 
-	res.RequestedVerb = verb
-	res.RequestingSubject = subject // maybe deep copy subject as it is a slice?
-	res.RequestedResource = resource
+// nonResourceURLContains returns true if one of the rule URLs `sl` matches the
+// requested path `s`. A rule URL ending with `*` matches all paths with the
+// preceding prefix.
+func nonResourceURLContains(sl []string, s string) bool {
+	for _, s2 := range sl {
+		if s2 == s || strings.HasSuffix(s2, "*") && strings.HasPrefix(s, s2[:len(s2)-1]) {
+			return true
+		}
+	}
+	return false
+}
 
-	return res
+// apiGroupContains returns true if one of the rule API groups `sl` matches the
+// requested API group `s`. An empty slice only matches the core group `""`.
+func apiGroupContains(sl []string, s string) bool {
+	if len(sl) == 0 {
+		return s == ""
+	}
+	for _, s2 := range sl {
+		if s2 == s || s2 == "*" {
+			return true
+		}
+	}
+	return false
 }
 
-// sMatchOrEmpty returns true if `s` is an empty string or equals to `s2`
-func sMatchOrEmpty(s, s2 string) bool {
-	return s == "" || s == s2
+// resourceContains returns true if one of the rule resources `sl` matches the
+// requested resource `s` in the form `resource` or `resource/subresource`.
+// The rule resource `*` matches every resource and subresource, `resource/*`
+// matches every subresource of a resource and `*/subresource` matches the
+// subresource of every resource.
+func resourceContains(sl []string, s string) bool {
+	for _, s2 := range sl {
+		if s2 == s || s2 == "*" {
+			return true
+		}
+	}
+
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return false
+	}
+	for _, s2 := range sl {
+		if strings.HasSuffix(s2, "/*") && s2[:len(s2)-1] == s[:i+1] ||
+			strings.HasPrefix(s2, "*/") && s2[1:] == s[i:] {
+			return true
+		}
+	}
+	return false
 }
 
 // sContains returns true if `sl` contains `s`.
@@ -2,9 +2,16 @@ package rbac
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Evaldata provides input data for a evaluation with the hint if it should validate
@@ -21,19 +28,6 @@ func (e Evaldata) String() string {
 		e.Resource.Namespace, e.Resource.Resource, e.Resource.ResourceName)
 }
 
-// TestSMatchOrEmpty tests the SMatchOrEmpty function
-func TestSMatchOrEmpty(t *testing.T) {
-	var failed bool
-	failed = failed || !sMatchOrEmpty("", "abcd")
-	failed = failed || sMatchOrEmpty("abcd", "")
-	failed = failed || !sMatchOrEmpty("abcd", "abcd")
-	failed = failed || sMatchOrEmpty("abcd", "abc")
-
-	if failed {
-		t.Fail()
-	}
-}
-
 // TestSContains tests the SContains function
 func TestSContains(t *testing.T) {
 	var failed bool
@@ -60,11 +54,11 @@ func TestSContains(t *testing.T) {
 func createTestdataBasic() ([]Role, []RoleBinding, []Evaldata) {
 	// Rule has the form: Verb, Ressource, RessourceName
 	rules := []Rule{
-		{[]string{"get"}, []string{"res-A"}, []string{"res-1"}},
-		{[]string{"delete"}, []string{"res-A"}, []string{}},
-		{[]string{"watch", "list"}, []string{"res-A", "res-B"}, []string{}},
-		{[]string{"patch"}, []string{"res-A", "res-B"}, []string{"res-2"}},
-		{[]string{"update"}, []string{"res-A", "res-B"}, []string{"res-1", "res-2"}},
+		{Verbs: []string{"get"}, Resources: []string{"res-A"}, ResourceNames: []string{"res-1"}},
+		{Verbs: []string{"delete"}, Resources: []string{"res-A"}, ResourceNames: []string{}},
+		{Verbs: []string{"watch", "list"}, Resources: []string{"res-A", "res-B"}, ResourceNames: []string{}},
+		{Verbs: []string{"patch"}, Resources: []string{"res-A", "res-B"}, ResourceNames: []string{"res-2"}},
+		{Verbs: []string{"update"}, Resources: []string{"res-A", "res-B"}, ResourceNames: []string{"res-1", "res-2"}},
 	}
 
 	roles := []Role{
@@ -92,12 +86,12 @@ func createTestdataBasic() ([]Role, []RoleBinding, []Evaldata) {
 
 	ev := []Evaldata{
 		{"get", []Subject{{}}, Resource{}, false},
-		{"get", []Subject{{"s-user", User}}, Resource{"", "res-A", "res-1"}, true},
-		{"get", []Subject{{"s-foo", User}}, Resource{"", "res-A", "res-1"}, false},
-		{"patch", []Subject{{"s-user", User}}, Resource{"", "res-A", "res-1"}, false},
-		{"get", []Subject{{"s-user", ServiceAccount}}, Resource{"", "res-A", "res-1"}, false},
-		{"delete", []Subject{{"s-user", User}}, Resource{"scope-1", "res-A", ""}, true},
-		{"delete", []Subject{{"s-user", User}}, Resource{"", "res-A", ""}, false},
+		{"get", []Subject{{"s-user", User}}, Resource{Namespace: "", Resource: "res-A", ResourceName: "res-1"}, true},
+		{"get", []Subject{{"s-foo", User}}, Resource{Namespace: "", Resource: "res-A", ResourceName: "res-1"}, false},
+		{"patch", []Subject{{"s-user", User}}, Resource{Namespace: "", Resource: "res-A", ResourceName: "res-1"}, false},
+		{"get", []Subject{{"s-user", ServiceAccount}}, Resource{Namespace: "", Resource: "res-A", ResourceName: "res-1"}, false},
+		{"delete", []Subject{{"s-user", User}}, Resource{Namespace: "scope-1", Resource: "res-A", ResourceName: ""}, true},
+		{"delete", []Subject{{"s-user", User}}, Resource{Namespace: "", Resource: "res-A", ResourceName: ""}, false},
 	}
 
 	return roles, rolebindings, ev
@@ -355,3 +349,449 @@ func TestRBACExtensive(t *testing.T) {
 		t.Errorf("Scanner had error %q", err)
 	}
 }
+
+// TestResourceContains tests the resourceContains function
+func TestResourceContains(t *testing.T) {
+	tests := []struct {
+		rules     []string
+		requested string
+		valid     bool
+	}{
+		{[]string{"nodes"}, "nodes", true},
+		{[]string{"nodes"}, "nodes/status", false},
+		{[]string{"nodes/status"}, "nodes/status", true},
+		{[]string{"nodes/status"}, "nodes", false},
+		{[]string{"nodes/*"}, "nodes/status", true},
+		{[]string{"nodes/*"}, "nodes", false},
+		{[]string{"nodes/*"}, "pods/status", false},
+		{[]string{"*/status"}, "pods/status", true},
+		{[]string{"*/status"}, "pods/logs", false},
+		{[]string{"*/status"}, "pods", false},
+		{[]string{"*"}, "pods", true},
+		{[]string{"*"}, "pods/logs", true},
+		{[]string{"pods", "*/logs"}, "pods/logs", true},
+		{[]string{}, "pods", false},
+	}
+
+	for _, test := range tests {
+		if resourceContains(test.rules, test.requested) != test.valid {
+			t.Errorf("resourceContains(%q, %q) should return %t", test.rules, test.requested, test.valid)
+		}
+	}
+}
+
+// TestRBACSubresources tests the evaluation of requests for subresources
+func TestRBACSubresources(t *testing.T) {
+	a := New()
+	err := a.SetRole(Role{Name: "debugger", Rules: []Rule{
+		{Verbs: []string{"get"}, Resources: []string{"pods/*", "*/status"}},
+		{Verbs: []string{"create"}, Resources: []string{"pods/exec"}, ResourceNames: []string{"shell"}},
+	}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "debuggers", Role: "debugger", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	subject := []Subject{{Name: "bofh", Kind: User}}
+	ev := []Evaldata{
+		{"get", subject, Resource{Resource: "pods", Subresource: "logs"}, true},
+		{"get", subject, Resource{Resource: "pods/logs"}, true},
+		{"get", subject, Resource{Resource: "pods"}, false},
+		{"get", subject, Resource{Resource: "nodes", Subresource: "status"}, true},
+		{"get", subject, Resource{Resource: "nodes", Subresource: "logs"}, false},
+		{"create", subject, Resource{Resource: "pods", Subresource: "exec", ResourceName: "shell"}, true},
+		{"create", subject, Resource{Resource: "pods", Subresource: "exec", ResourceName: "db"}, false},
+	}
+
+	for _, e := range ev {
+		res := a.Eval(e.Verb, e.Subject, e.Resource)
+		if res.Success != e.Valid {
+			t.Errorf("Expected success to be %t: %s", e.Valid, res)
+		}
+	}
+}
+
+// TestRBACAPIGroups tests the evaluation of requests for resources of API groups
+func TestRBACAPIGroups(t *testing.T) {
+	a := New()
+	err := a.SetRole(Role{Name: "job-runner", Rules: []Rule{
+		{Verbs: []string{"create"}, Resources: []string{"jobs"}},
+		{Verbs: []string{"get"}, APIGroups: []string{"batch", "cron"}, Resources: []string{"jobs"}},
+		{Verbs: []string{"list"}, APIGroups: []string{"*"}, Resources: []string{"jobs"}},
+		{Verbs: []string{"watch"}, APIGroups: []string{""}, Resources: []string{"jobs/status"}},
+	}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "job-runners", Role: "job-runner", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	subject := []Subject{{Name: "bofh", Kind: User}}
+	ev := []Evaldata{
+		{"create", subject, Resource{Resource: "jobs"}, true},
+		{"create", subject, Resource{APIGroup: "batch", Resource: "jobs"}, false},
+		{"get", subject, Resource{APIGroup: "batch", Resource: "jobs"}, true},
+		{"get", subject, Resource{APIGroup: "cron", Resource: "jobs"}, true},
+		{"get", subject, Resource{Resource: "jobs"}, false},
+		{"list", subject, Resource{APIGroup: "plugin", Resource: "jobs"}, true},
+		{"list", subject, Resource{Resource: "jobs"}, true},
+		{"watch", subject, Resource{Resource: "jobs", Subresource: "status"}, true},
+		{"watch", subject, Resource{APIGroup: "batch", Resource: "jobs", Subresource: "status"}, false},
+	}
+
+	for _, e := range ev {
+		res := a.Eval(e.Verb, e.Subject, e.Resource)
+		if res.Success != e.Valid {
+			t.Errorf("Expected success to be %t: %s", e.Valid, res)
+		}
+	}
+
+	res := Resource{Namespace: "ns", APIGroup: "batch", Resource: "jobs", Subresource: "status", ResourceName: "x"}
+	if res.String() != `"ns":"jobs.batch/status":"x"` {
+		t.Errorf("Unexpected resource string %s", res)
+	}
+}
+
+// TestRBACNonResourceURLs tests the evaluation of requests for non-resource URLs
+func TestRBACNonResourceURLs(t *testing.T) {
+	a := New()
+	if err := a.SetRole(Role{Name: "invalid", Rules: []Rule{{Verbs: []string{"get"}}}}); err == nil {
+		t.Fatal("SetRole should fail for a rule without resources and non-resource URLs")
+	}
+
+	err := a.SetRole(Role{Name: "monitoring", Rules: []Rule{
+		{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz", "/metrics", "/debug/pprof/*"}},
+	}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "monitors", Role: "monitoring", Subjects: []Subject{{Name: "prometheus", Kind: ServiceAccount}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "scoped-monitors", Role: "monitoring", Namespace: "alpha", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	// A global rule for all resources must not grant an empty path
+	err = a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"*"}}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "readers", Role: "reader", Subjects: []Subject{{Name: "scraper", Kind: ServiceAccount}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	prometheus := []Subject{{Name: "prometheus", Kind: ServiceAccount}}
+	tests := []struct {
+		verb    string
+		subject []Subject
+		path    string
+		valid   bool
+	}{
+		{"get", prometheus, "/healthz", true},
+		{"get", prometheus, "/metrics", true},
+		{"get", prometheus, "/metrics/extra", false},
+		{"get", prometheus, "/debug/pprof/", true},
+		{"get", prometheus, "/debug/pprof/heap", true},
+		{"get", prometheus, "/debug", false},
+		{"post", prometheus, "/healthz", false},
+		{"get", []Subject{{Name: "bofh", Kind: User}}, "/healthz", false},
+		{"get", []Subject{{Name: "scraper", Kind: ServiceAccount}}, "", false},
+	}
+
+	for _, test := range tests {
+		res := a.EvalNonResource(test.verb, test.subject, test.path)
+		if res.Success != test.valid {
+			t.Errorf("Expected success to be %t: %s", test.valid, res)
+		}
+		res = a.For(test.subject).CheckNonResource(test.verb, test.path)
+		if res.Success != test.valid {
+			t.Errorf("Expected success of the Checker to be %t: %s", test.valid, res)
+		}
+	}
+
+	// Non-resource rules must not grant resources
+	res := a.Eval("get", prometheus, Resource{Resource: "/healthz"})
+	if res.Success {
+		t.Errorf("Should not validate, but did: %s", res)
+	}
+}
+
+// TestRBACNamespaceHierarchy tests the inheritance of RoleBindings in a namespace hierarchy
+func TestRBACNamespaceHierarchy(t *testing.T) {
+	a := New()
+	err := a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"jobs"}}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "org-readers", Role: "reader", Namespace: "org-a", Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	subject := []Subject{{Name: "bofh", Kind: User}}
+	res := a.Eval("get", subject, Resource{Namespace: "org-a/team-1/proj-x", Resource: "jobs"})
+	if res.Success {
+		t.Fatalf("Should not validate without hierarchy, but did: %s", res)
+	}
+
+	a.SetNamespaceParent(PathNamespaceParent("/"))
+	ev := []Evaldata{
+		{"get", subject, Resource{Namespace: "org-a", Resource: "jobs"}, true},
+		{"get", subject, Resource{Namespace: "org-a/team-1", Resource: "jobs"}, true},
+		{"get", subject, Resource{Namespace: "org-a/team-1/proj-x", Resource: "jobs"}, true},
+		{"get", subject, Resource{Namespace: "org-b/team-1", Resource: "jobs"}, false},
+		{"get", subject, Resource{Namespace: "org-ab", Resource: "jobs"}, false},
+		{"get", subject, Resource{Resource: "jobs"}, false},
+	}
+	for _, e := range ev {
+		res := a.Eval(e.Verb, e.Subject, e.Resource)
+		if res.Success != e.Valid {
+			t.Errorf("Expected success to be %t: %s", e.Valid, res)
+		}
+		if res.Success && res.Namespace != "org-a" {
+			t.Errorf("Expected org-a to grant the access, got %q", res.Namespace)
+		}
+	}
+
+	// A cyclic hierarchy must not loop forever
+	a.SetNamespaceParent(func(string) string { return "loop" })
+	if res := a.Eval("get", subject, Resource{Namespace: "loop", Resource: "jobs"}); res.Success {
+		t.Errorf("Should not validate, but did: %s", res)
+	}
+}
+
+// TestRBACMultiNamespaceBindings tests RoleBindings with namespace lists and selectors
+func TestRBACMultiNamespaceBindings(t *testing.T) {
+	a := New()
+	err := a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"jobs"}}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+
+	if err := a.SetNamespace(Namespace{}); err == nil {
+		t.Fatal("SetNamespace should fail for a namespace without name")
+	}
+
+	for _, ns := range []Namespace{
+		{Name: "team-a-prod", Labels: map[string]string{"team": "a", "env": "prod"}},
+		{Name: "team-a-dev", Labels: map[string]string{"team": "a", "env": "dev"}},
+		{Name: "team-b-dev", Labels: map[string]string{"team": "b", "env": "dev"}},
+	} {
+		if err := a.SetNamespace(ns); err != nil {
+			t.Fatalf("SetNamespace failed with %q", err)
+		}
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "invalid", Role: "reader", Namespaces: []string{""}, Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err == nil {
+		t.Fatal("SetRoleBinding should fail for an empty namespace in the list")
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "listed", Role: "reader", Namespace: "alpha", Namespaces: []string{"beta", "gamma"},
+		Subjects: []Subject{{Name: "bofh", Kind: User}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	err = a.SetRoleBinding(RoleBinding{Name: "selected", Role: "reader", NamespaceSelector: map[string]string{"team": "a"},
+		Subjects: []Subject{{Name: "team-a", Kind: Group}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	bofh := []Subject{{Name: "bofh", Kind: User}}
+	teamA := []Subject{{Name: "team-a", Kind: Group}}
+	ev := []Evaldata{
+		{"get", bofh, Resource{Namespace: "alpha", Resource: "jobs"}, true},
+		{"get", bofh, Resource{Namespace: "beta", Resource: "jobs"}, true},
+		{"get", bofh, Resource{Namespace: "gamma", Resource: "jobs"}, true},
+		{"get", bofh, Resource{Namespace: "delta", Resource: "jobs"}, false},
+		{"get", bofh, Resource{Resource: "jobs"}, false},
+		{"get", teamA, Resource{Namespace: "team-a-prod", Resource: "jobs"}, true},
+		{"get", teamA, Resource{Namespace: "team-a-dev", Resource: "jobs"}, true},
+		{"get", teamA, Resource{Namespace: "team-b-dev", Resource: "jobs"}, false},
+		{"get", teamA, Resource{Namespace: "unknown", Resource: "jobs"}, false},
+		{"get", teamA, Resource{Resource: "jobs"}, false},
+	}
+	for _, e := range ev {
+		res := a.Eval(e.Verb, e.Subject, e.Resource)
+		if res.Success != e.Valid {
+			t.Errorf("Expected success to be %t: %s", e.Valid, res)
+		}
+		if res.Success && res.Namespace != e.Resource.Namespace {
+			t.Errorf("Expected %q to grant the access, got %q", e.Resource.Namespace, res.Namespace)
+		}
+	}
+
+	// Relabeling a namespace changes the selected namespaces
+	a.SetNamespace(Namespace{Name: "team-b-dev", Labels: map[string]string{"team": "a"}})
+	if res := a.Eval("get", teamA, Resource{Namespace: "team-b-dev", Resource: "jobs"}); !res.Success {
+		t.Errorf("Should validate, but didn't: %s", res)
+	}
+
+	a.DeleteNamespace("team-b-dev")
+	if res := a.Eval("get", teamA, Resource{Namespace: "team-b-dev", Resource: "jobs"}); res.Success {
+		t.Errorf("Should not validate, but did: %s", res)
+	}
+}
+
+// testResolver is a SubjectResolver that adds groups from a static map
+type testResolver struct {
+	groups map[string][]string
+	err    error
+}
+
+func (r testResolver) ResolveSubjects(ctx context.Context, subjects []Subject) ([]Subject, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	ret := append([]Subject{}, subjects...)
+	for _, s := range subjects {
+		for _, g := range r.groups[s.Name] {
+			ret = append(ret, Subject{Name: g, Kind: Group})
+		}
+	}
+	return ret, nil
+}
+
+// testAuditSink is an AuditSink that records the results
+type testAuditSink struct {
+	results []Result
+	err     error
+}
+
+func (s *testAuditSink) Audit(ctx context.Context, req Request, res Result, at time.Time) error {
+	s.results = append(s.results, res)
+	return s.err
+}
+
+// TestEvalContext tests the evaluation with context, resolvers and audit sinks
+func TestEvalContext(t *testing.T) {
+	a := New()
+	err := a.SetRole(Role{Name: "reader", Rules: []Rule{{Verbs: []string{"get"}, Resources: []string{"jobs"}}}})
+	if err != nil {
+		t.Fatalf("SetRole failed with %q", err)
+	}
+	err = a.SetRoleBinding(RoleBinding{Name: "readers", Role: "reader", Subjects: []Subject{{Name: "readers", Kind: Group}}})
+	if err != nil {
+		t.Fatalf("SetRoleBinding failed with %q", err)
+	}
+
+	req := Request{Verb: "get", Subjects: []Subject{{Name: "bofh", Kind: User}}, Resource: Resource{Resource: "jobs"}}
+	res, err := a.EvalContext(context.Background(), req)
+	if err != nil || res.Success {
+		t.Fatalf("Should not validate without resolver: %s, %v", res, err)
+	}
+
+	sink := &testAuditSink{}
+	a.SetAuditSink(sink)
+	a.SetSubjectResolver(testResolver{groups: map[string][]string{"bofh": {"readers"}}})
+	res, err = a.EvalContext(context.Background(), req)
+	if err != nil || !res.Success || res.Subject != "readers" {
+		t.Fatalf("Should validate with resolved groups: %s, %v", res, err)
+	}
+	if len(sink.results) != 1 || !sink.results[0].Success {
+		t.Fatalf("Audit sink should have received the result, got %v", sink.results)
+	}
+
+	if res := a.Eval(req.Verb, req.Subjects, req.Resource); !res.Success {
+		t.Fatalf("Eval should use the resolver: %s", res)
+	}
+
+	// Errors are surfaced instead of silently denying
+	resolverErr := errors.New("directory unavailable")
+	a.SetSubjectResolver(testResolver{err: resolverErr})
+	res, err = a.EvalContext(context.Background(), req)
+	if !errors.Is(err, resolverErr) || res.Success {
+		t.Fatalf("Expected resolver error, got %s, %v", res, err)
+	}
+	if res := a.Eval(req.Verb, req.Subjects, req.Resource); res.Success {
+		t.Fatalf("Eval should deny if the resolver fails: %s", res)
+	}
+
+	a.SetSubjectResolver(nil)
+	sinkErr := errors.New("disk full")
+	sink.err = sinkErr
+	if res, err := a.EvalContext(context.Background(), req); !errors.Is(err, sinkErr) || res.Success {
+		t.Fatalf("Expected audit error, got %s, %v", res, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res, err := a.EvalContext(ctx, req); err != context.Canceled || res.Success {
+		t.Fatalf("Expected context error, got %s, %v", res, err)
+	}
+}
+
+// TestParseSubjectKind tests the text encoding of subject kinds
+func TestParseSubjectKind(t *testing.T) {
+	tests := map[string]SubjectKind{
+		"User":           User,
+		"user":           User,
+		"GROUP":          Group,
+		"ServiceAccount": ServiceAccount,
+		"serviceaccount": ServiceAccount,
+		"sa":             ServiceAccount,
+	}
+	for s, expected := range tests {
+		kind, err := ParseSubjectKind(s)
+		if err != nil || kind != expected {
+			t.Errorf("ParseSubjectKind(%q) returned %s, %v", s, kind, err)
+		}
+	}
+
+	_, err := ParseSubjectKind("robot")
+	if e, ok := err.(*UnknownSubjectKindError); !ok || e.Kind != "robot" {
+		t.Errorf("Expected UnknownSubjectKindError, got %v", err)
+	}
+
+	var kind SubjectKind
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&kind, "kind", "subject kind")
+	if err := fs.Parse([]string{"-kind", "sa"}); err != nil || kind != ServiceAccount {
+		t.Errorf("Flag should be parsed as ServiceAccount, got %s, %v", kind, err)
+	}
+
+	b, err := json.Marshal(map[SubjectKind]SubjectKind{Group: User})
+	if err != nil || string(b) != `{"Group":"User"}` {
+		t.Errorf("Unexpected JSON encoding %s, %v", b, err)
+	}
+	if _, err := SubjectKind(7).MarshalText(); err == nil {
+		t.Error("Invalid kinds should not be encoded")
+	}
+	if err := kind.Set(""); err == nil {
+		t.Error("Flag should require a kind")
+	}
+
+	// The zero kind of denied results is encoded as empty text
+	res := New().Eval("get", []Subject{{Name: "bofh", Kind: User}}, Resource{Resource: "nodes"})
+	b, err = json.Marshal(res)
+	if err != nil {
+		t.Fatalf("Marshalling a denied result as JSON failed with %q", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded.SubjectType != 0 || decoded.Request.Verb != "get" {
+		t.Errorf("Decoding a denied result returned %+v, %v", decoded, err)
+	}
+	if _, err := yaml.Marshal(res); err != nil {
+		t.Errorf("Marshalling a denied result as YAML failed with %q", err)
+	}
+
+	if s := (Subject{Name: "bofh"}).String(); s != "SubjectKind(0):bofh" {
+		t.Errorf("Invalid kind should be printed, got %q", s)
+	}
+}
@@ -0,0 +1,116 @@
+// Package rbacmetrics exposes the counters of an rbac.MetricsRecorder in the
+// Prometheus text exposition format and through expvar. It is kept apart from
+// the rbac package because importing expvar registers /debug/vars on the
+// default HTTP mux:
+//
+//	metrics := rbac.NewMetricsRecorder()
+//	authz.SetMetrics(metrics)
+//	http.Handle("/metrics", rbacmetrics.Handler(metrics))
+//	expvar.Publish("rbac", rbacmetrics.Var(metrics))
+package rbacmetrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/djboris9/rbac"
+)
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, m *rbac.MetricsRecorder) error {
+	s := m.Snapshot()
+	var b strings.Builder
+
+	b.WriteString("# HELP rbac_decisions_total Authorization decisions by verb, resource and outcome.\n")
+	b.WriteString("# TYPE rbac_decisions_total counter\n")
+	for _, d := range s.Decisions {
+		fmt.Fprintf(&b, "rbac_decisions_total{verb=%s,resource=%s,outcome=%q} %d\n",
+			promLabel(d.Verb), promLabel(d.Resource), outcome(d.Allowed), d.Count)
+	}
+
+	b.WriteString("# HELP rbac_evaluation_duration_seconds Latency of authorization decisions.\n")
+	b.WriteString("# TYPE rbac_evaluation_duration_seconds histogram\n")
+	for i, le := range s.Buckets {
+		fmt.Fprintf(&b, "rbac_evaluation_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), s.BucketCounts[i])
+	}
+	fmt.Fprintf(&b, "rbac_evaluation_duration_seconds_bucket{le=\"+Inf\"} %d\n", s.LatencyCount)
+	fmt.Fprintf(&b, "rbac_evaluation_duration_seconds_sum %s\n", strconv.FormatFloat(s.LatencySum, 'g', -1, 64))
+	fmt.Fprintf(&b, "rbac_evaluation_duration_seconds_count %d\n", s.LatencyCount)
+
+	b.WriteString("# HELP rbac_roles Number of Roles.\n")
+	b.WriteString("# TYPE rbac_roles gauge\n")
+	fmt.Fprintf(&b, "rbac_roles %d\n", s.Roles)
+	b.WriteString("# HELP rbac_rolebindings Number of RoleBindings.\n")
+	b.WriteString("# TYPE rbac_rolebindings gauge\n")
+	fmt.Fprintf(&b, "rbac_rolebindings %d\n", s.RoleBindings)
+
+	b.WriteString("# HELP rbac_rolebinding_hits_total Requests granted by RoleBinding.\n")
+	b.WriteString("# TYPE rbac_rolebinding_hits_total counter\n")
+	bindings := make([]string, 0, len(s.BindingHits))
+	for name := range s.BindingHits {
+		bindings = append(bindings, name)
+	}
+	sort.Strings(bindings)
+	for _, name := range bindings {
+		fmt.Fprintf(&b, "rbac_rolebinding_hits_total{rolebinding=%s} %d\n", promLabel(name), s.BindingHits[name])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler returns a http.Handler that serves the metrics in the Prometheus
+// text exposition format
+func Handler(m *rbac.MetricsRecorder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w, m)
+	})
+}
+
+// Var returns the metrics as expvar.Var, which can be published with
+// expvar.Publish
+func Var(m *rbac.MetricsRecorder) expvar.Var {
+	return expvar.Func(func() interface{} {
+		s := m.Snapshot()
+
+		decisions := map[string]uint64{}
+		for _, d := range s.Decisions {
+			decisions[d.Verb+" "+d.Resource+" "+outcome(d.Allowed)] = d.Count
+		}
+
+		buckets := map[string]uint64{}
+		for i, le := range s.Buckets {
+			buckets[strconv.FormatFloat(le, 'g', -1, 64)] = s.BucketCounts[i]
+		}
+
+		return map[string]interface{}{
+			"decisions":       decisions,
+			"rolebindingHits": s.BindingHits,
+			"latencyBuckets":  buckets,
+			"latencySum":      s.LatencySum,
+			"latencyCount":    s.LatencyCount,
+			"roles":           s.Roles,
+			"rolebindings":    s.RoleBindings,
+		}
+	})
+}
+
+// outcome returns the outcome label of a decision
+func outcome(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "denied"
+}
+
+// promLabel quotes a label value for the Prometheus text exposition format
+func promLabel(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
@@ -0,0 +1,62 @@
+package rbacmetrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/djboris9/rbac"
+)
+
+// TestExposition tests the Prometheus and expvar exposition of the counters
+func TestExposition(t *testing.T) {
+	a := rbac.New()
+	if err := a.LoadDir(filepath.Join("..", "example.yaml")); err != nil {
+		t.Fatalf("Loading example.yaml failed with %q", err)
+	}
+	m := rbac.NewMetricsRecorder()
+	a.SetMetrics(m)
+
+	subject := []rbac.Subject{{Name: "bofh", Kind: rbac.User}}
+	a.Eval("get", subject, rbac.Resource{Namespace: "linux", Resource: "nodes"})
+	a.Eval("delete", subject, rbac.Resource{Namespace: "linux", Resource: "nodes"})
+	a.EvalNonResource("get", subject, "/healthz")
+	a.Eval("list", subject, rbac.Resource{Namespace: "linux", Resource: "nodes", APIGroup: "apps", Subresource: "states"})
+
+	w := httptest.NewRecorder()
+	Handler(m).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	out := w.Body.String()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+
+	for _, line := range []string{
+		`rbac_decisions_total{verb="get",resource="nodes",outcome="allowed"} 1`,
+		`rbac_decisions_total{verb="delete",resource="nodes",outcome="denied"} 1`,
+		`rbac_decisions_total{verb="get",resource="nonResourceURL",outcome="denied"} 1`,
+		`rbac_decisions_total{verb="list",resource="nodes.apps/states",outcome="denied"} 1`,
+		`rbac_evaluation_duration_seconds_bucket{le="+Inf"} 4`,
+		`rbac_evaluation_duration_seconds_count 4`,
+		`rbac_roles 2`,
+		`rbac_rolebindings 3`,
+		`rbac_rolebinding_hits_total{rolebinding="linux-node-watchers"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Exposition should contain %q:\n%s", line, out)
+		}
+	}
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(Var(m).String()), &vars); err != nil {
+		t.Fatalf("expvar output isn't valid JSON: %s", err)
+	}
+	if vars["latencyCount"] != float64(4) {
+		t.Errorf("Unexpected expvar output %v", vars)
+	}
+
+	if promLabel("a\"b\\c\nd") != `"a\"b\\c\nd"` {
+		t.Errorf("Label isn't escaped: %s", promLabel("a\"b\\c\nd"))
+	}
+}
@@ -0,0 +1,282 @@
+// Package rbactest runs declarative test cases against a policy. Test files
+// contain a YAML sequence of cases that state whether a request must be
+// allowed or denied and optionally by which RoleBinding:
+//
+//	# tests/example.yaml
+//	- name: bofh watches linux nodes
+//	  as: {user: bofh, groups: [admins]}
+//	  verb: get
+//	  resource: nodes
+//	  namespace: linux
+//	  expect: allow
+//	  via: linux-node-watchers
+//	- as: {serviceAccount: auditor}
+//	  verb: delete
+//	  resource: deployments.apps
+//	  resourceName: web
+//	  subresource: scale
+//	  namespace: linux
+//	  expect: deny
+//
+// The resource has the form `resource[.group]`, its name and subresource are
+// given by separate fields. Non-resource requests set `path` instead. Test
+// files run with `go test` through Run or with `rbacctl test`.
+package rbactest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/djboris9/rbac"
+	"gopkg.in/yaml.v3"
+)
+
+// Expectation is the expected decision of a test case
+type Expectation string
+
+// The Expectations of a test case
+const (
+	Allow Expectation = "allow"
+	Deny  Expectation = "deny"
+)
+
+// Subjects represents the requesting subjects of a test case
+type Subjects struct {
+	User            string   `yaml:"user,omitempty"`
+	Groups          []string `yaml:"groups,omitempty"`
+	ServiceAccount  string   `yaml:"serviceAccount,omitempty"`
+	ServiceAccounts []string `yaml:"serviceAccounts,omitempty"`
+}
+
+// Case represents a test case. Source is the position of the case in its test
+// file and is set by ReadFile.
+type Case struct {
+	Name         string            `yaml:"name,omitempty"`
+	As           Subjects          `yaml:"as"`
+	Verb         string            `yaml:"verb"`
+	Resource     string            `yaml:"resource,omitempty"`
+	ResourceName string            `yaml:"resourceName,omitempty"`
+	Subresource  string            `yaml:"subresource,omitempty"`
+	Namespace    string            `yaml:"namespace,omitempty"`
+	Path         string            `yaml:"path,omitempty"`
+	Attributes   map[string]string `yaml:"attributes,omitempty"`
+	Extra        map[string]string `yaml:"extra,omitempty"`
+	Expect       Expectation       `yaml:"expect"`
+	Via          string            `yaml:"via,omitempty"`
+	Source       string            `yaml:"-"`
+}
+
+// String returns the name of the case or describes its request if it has none
+func (c Case) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+
+	target := c.Path
+	if target == "" {
+		target = c.Resource
+		if c.ResourceName != "" {
+			target += " " + c.ResourceName
+		}
+		if c.Subresource != "" {
+			target += " (" + c.Subresource + ")"
+		}
+		if c.Namespace != "" {
+			target += " in " + c.Namespace
+		}
+	}
+	return fmt.Sprintf("%s %s %s", c.As, c.Verb, target)
+}
+
+func (s Subjects) String() string {
+	var names []string
+	for _, subject := range s.subjects() {
+		names = append(names, subject.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// subjects returns the requesting subjects
+func (s Subjects) subjects() []rbac.Subject {
+	var ret []rbac.Subject
+	if s.User != "" {
+		ret = append(ret, rbac.Subject{Name: s.User, Kind: rbac.User})
+	}
+	for _, g := range s.Groups {
+		ret = append(ret, rbac.Subject{Name: g, Kind: rbac.Group})
+	}
+	if s.ServiceAccount != "" {
+		ret = append(ret, rbac.Subject{Name: s.ServiceAccount, Kind: rbac.ServiceAccount})
+	}
+	for _, sa := range s.ServiceAccounts {
+		ret = append(ret, rbac.Subject{Name: sa, Kind: rbac.ServiceAccount})
+	}
+	return ret
+}
+
+// ParseResource parses a resource in the form `resource[.group]`, such as
+// `deployments.apps`. A `/` is rejected, as `resource/x` could either address
+// a resource name or a subresource, which are set separately.
+func ParseResource(s string) (rbac.Resource, error) {
+	var res rbac.Resource
+	res.Resource = s
+	if i := strings.IndexByte(res.Resource, '.'); i >= 0 {
+		res.Resource, res.APIGroup = res.Resource[:i], res.Resource[i+1:]
+	}
+	if res.Resource == "" || strings.ContainsRune(s, '/') {
+		return rbac.Resource{}, fmt.Errorf("invalid resource %q, expected resource[.group]", s)
+	}
+	return res, nil
+}
+
+// Request returns the request of the case
+func (c Case) Request() (rbac.Request, error) {
+	req := rbac.Request{Verb: c.Verb, Subjects: c.As.subjects(), Path: c.Path, Extra: c.Extra}
+	if c.Path != "" {
+		return req, nil
+	}
+
+	res, err := ParseResource(c.Resource)
+	if err != nil {
+		return rbac.Request{}, err
+	}
+	res.Namespace = c.Namespace
+	res.ResourceName = c.ResourceName
+	res.Subresource = c.Subresource
+	res.Attributes = c.Attributes
+	req.Resource = res
+	return req, nil
+}
+
+// validate checks that the case describes a complete request and expectation
+func (c Case) validate() error {
+	switch {
+	case len(c.As.subjects()) == 0:
+		return errors.New("as has no subjects")
+	case c.Verb == "":
+		return errors.New("verb is missing")
+	case c.Resource == "" && c.Path == "":
+		return errors.New("resource or path is missing")
+	case c.Resource != "" && c.Path != "":
+		return errors.New("resource and path are mutually exclusive")
+	case c.Expect != Allow && c.Expect != Deny:
+		return fmt.Errorf("expect must be %q or %q, got %q", Allow, Deny, c.Expect)
+	case c.Via != "" && c.Expect != Allow:
+		return errors.New("via requires expect: allow")
+	}
+
+	_, err := c.Request()
+	return err
+}
+
+// ReadFile reads the test cases of a YAML file
+func ReadFile(file string) ([]Case, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var doc yaml.Node
+	if err := yaml.NewDecoder(f).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	if doc.Content[0].Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s:%d: expected a sequence of test cases", file, doc.Content[0].Line)
+	}
+
+	var cases []Case
+	for _, node := range doc.Content[0].Content {
+		var c Case
+		src := fmt.Sprintf("%s:%d", file, node.Line)
+		if err := node.Decode(&c); err != nil {
+			return nil, fmt.Errorf("%s: %s", src, err)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", src, c, err)
+		}
+		c.Source = src
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// ReadFiles reads the test cases of all files matching the patterns as
+// described by filepath.Match
+func ReadFiles(patterns ...string) ([]Case, error) {
+	var cases []Case
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no test files match %q", pattern)
+		}
+
+		for _, file := range files {
+			c, err := ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, c...)
+		}
+	}
+	return cases, nil
+}
+
+// Check evaluates the request of the case with EvalContext and returns an error
+// if the decision or the granting RoleBinding isn't the expected one. The
+// error contains the explanation of the request, see Authorizer.Explain.
+func (c Case) Check(a *rbac.Authorizer) error {
+	req, err := c.Request()
+	if err != nil {
+		return err
+	}
+
+	res, err := a.EvalContext(context.Background(), req)
+	if err != nil {
+		return err
+	}
+
+	var failure string
+	switch {
+	case c.Expect == Allow && !res.Success:
+		failure = "expected allow, got deny"
+	case c.Expect == Deny && res.Success:
+		failure = fmt.Sprintf("expected deny, got allow via %s", res.RoleBinding)
+	case c.Via != "" && res.RoleBinding != c.Via:
+		failure = fmt.Sprintf("expected allow via %s, got allow via %s", c.Via, res.RoleBinding)
+	default:
+		return nil
+	}
+
+	// The request of the result contains the resolved subjects
+	return fmt.Errorf("%s\n%s", failure, a.Explain(res.Request))
+}
+
+// Run reads the test cases of all files matching the patterns and runs every
+// case as subtest of `t` against the Authorizer, see Check
+func Run(t *testing.T, a *rbac.Authorizer, patterns ...string) {
+	cases, err := ReadFiles(patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.String(), func(t *testing.T) {
+			if err := c.Check(a); err != nil {
+				t.Errorf("%s: %s", c.Source, err)
+			}
+		})
+	}
+}
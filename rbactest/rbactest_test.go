@@ -0,0 +1,86 @@
+package rbactest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/djboris9/rbac"
+)
+
+// loadExample returns an Authorizer with the policy of example.yaml
+func loadExample(t *testing.T) *rbac.Authorizer {
+	a := rbac.New()
+	if err := a.LoadDir(filepath.Join("..", "example.yaml")); err != nil {
+		t.Fatalf("Loading example.yaml failed with %q", err)
+	}
+	return a
+}
+
+// TestRun tests running the test cases of testdata against example.yaml
+func TestRun(t *testing.T) {
+	Run(t, loadExample(t), filepath.Join("testdata", "*.yaml"))
+}
+
+// TestCheck tests the failure messages of test cases
+func TestCheck(t *testing.T) {
+	a := loadExample(t)
+
+	c := Case{As: Subjects{User: "bofh"}, Verb: "get", Resource: "nodes", Namespace: "windows", Expect: Allow}
+	err := c.Check(a)
+	if err == nil {
+		t.Fatal("Case should fail")
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "expected allow, got deny\n") ||
+		!strings.Contains(msg, `linux-node-watchers (role node-watcher): doesn't apply to namespace "windows"`) {
+		t.Errorf("Unexpected failure message:\n%s", msg)
+	}
+
+	c = Case{As: Subjects{User: "bofh", Groups: []string{"superusers"}}, Verb: "get", Resource: "nodes", Namespace: "linux",
+		Expect: Allow, Via: "linux-node-watchers"}
+	if err := c.Check(a); err == nil || !strings.HasPrefix(err.Error(), "expected allow via linux-node-watchers, got allow via global-node-watchers") {
+		t.Errorf("Unexpected failure %v", err)
+	}
+
+	c = Case{As: Subjects{ServiceAccount: "auditor"}, Verb: "list", Resource: "locations", Expect: Deny}
+	if err := c.Check(a); err == nil || !strings.HasPrefix(err.Error(), "expected deny, got allow via readonly-services") {
+		t.Errorf("Unexpected failure %v", err)
+	}
+}
+
+// TestReadFile tests that invalid test cases are reported with their position
+func TestReadFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rbactest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "invalid.yaml")
+	data := "- as: {user: bofh}\n  verb: get\n  resource: nodes\n  expect: allow\n- as: {user: bofh}\n  verb: get\n  resource: nodes\n  expect: maybe\n"
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReadFile(file)
+	if err == nil || !strings.HasPrefix(err.Error(), file+`:5: User:bofh get nodes: expect must be "allow" or "deny"`) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+// TestParseResource tests parsing resources with API group
+func TestParseResource(t *testing.T) {
+	res, err := ParseResource("deployments.apps")
+	if err != nil || !reflect.DeepEqual(res, rbac.Resource{Resource: "deployments", APIGroup: "apps"}) {
+		t.Errorf("Unexpected resource %+v, %v", res, err)
+	}
+	if _, err := ParseResource(".apps"); err == nil {
+		t.Error("Resource without name should fail")
+	}
+	if _, err := ParseResource("nodes/states"); err == nil {
+		t.Error("Resource with a slash should fail as it is ambiguous")
+	}
+}
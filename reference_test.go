@@ -0,0 +1,484 @@
+package rbac
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// referenceDecision is the decision of the reference evaluator
+type referenceDecision struct {
+	Success     bool
+	RoleBinding string
+	Rule        int
+	Subject     Subject
+	Namespace   string
+}
+
+// referenceConditions are the conditions the reference evaluator models, as
+// Go functions of the request, the subject and the time
+var referenceConditions = map[string]func(req Request, s Subject, now time.Time) bool{
+	`attr.owner == subject.name`: func(req Request, s Subject, now time.Time) bool {
+		return req.Resource.Attributes["owner"] == s.Name
+	},
+	`hour() >= 9 && hour() < 17`: func(req Request, s Subject, now time.Time) bool {
+		return now.Hour() >= 9 && now.Hour() < 17
+	},
+	`subject.kind == "Group" || extra.ip == "10.0.0.1"`: func(req Request, s Subject, now time.Time) bool {
+		return s.Kind == Group || req.Extra["ip"] == "10.0.0.1"
+	},
+}
+
+// referenceEval is a deliberately simple implementation of the evaluation
+// semantics that serves as oracle for the optimized evaluators. It walks the
+// RoleBindings by name and the rules in order without any index or cache.
+// Only the conditions of referenceConditions are supported. A rule with a
+// condition applies if it holds for one of the matching subjects, the last
+// one is preferred like for rules without a condition.
+func referenceEval(p Policy, parent func(string) string, now time.Time, req Request) referenceDecision {
+	roles := map[string]Role{}
+	for _, r := range p.Roles {
+		roles[r.Name] = r
+	}
+	labels := map[string]map[string]string{}
+	for _, n := range p.Namespaces {
+		labels[n.Name] = n.Labels
+	}
+
+	bindings := append([]RoleBinding(nil), p.RoleBindings...)
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].Name < bindings[j].Name })
+
+	// Non-resource URLs are only granted by global RoleBindings
+	namespace := req.Resource.Namespace
+	if req.Path != "" {
+		namespace = ""
+	}
+
+	for _, rb := range bindings {
+		if !rb.NotBefore.IsZero() && now.Before(rb.NotBefore) || !rb.NotAfter.IsZero() && !now.Before(rb.NotAfter) {
+			continue
+		}
+
+		var subjects []Subject
+		for _, rs := range req.Subjects {
+			for _, s := range rb.Subjects {
+				if s == rs {
+					subjects = append(subjects, s)
+				}
+			}
+		}
+		role, roleOk := roles[rb.Role]
+		if len(subjects) == 0 || !roleOk {
+			continue
+		}
+
+		scope, scopeOk := referenceScope(rb, labels, parent, namespace)
+		if !scopeOk {
+			continue
+		}
+
+		for i, rule := range role.Rules {
+			if !referenceRuleMatches(rule, req) {
+				continue
+			}
+			for j := len(subjects) - 1; j >= 0; j-- {
+				if rule.Condition == "" && j == len(subjects)-1 || rule.Condition != "" && referenceConditions[rule.Condition](req, subjects[j], now) {
+					return referenceDecision{Success: true, RoleBinding: rb.Name, Rule: i, Subject: subjects[j], Namespace: scope}
+				}
+			}
+		}
+	}
+	return referenceDecision{}
+}
+
+// referenceScope returns the namespace through which a RoleBinding applies to
+// a namespace, walking up the hierarchy for at most maxNamespaceDepth ancestors
+func referenceScope(rb RoleBinding, labels map[string]map[string]string, parent func(string) string, namespace string) (string, bool) {
+	if rb.Namespace == "" && len(rb.Namespaces) == 0 && len(rb.NamespaceSelector) == 0 {
+		return "", true
+	}
+
+	for depth := 0; namespace != "" && depth <= maxNamespaceDepth; depth++ {
+		if rb.Namespace == namespace {
+			return namespace, true
+		}
+		for _, ns := range rb.Namespaces {
+			if ns == namespace {
+				return namespace, true
+			}
+		}
+		if l, ok := labels[namespace]; ok && len(rb.NamespaceSelector) > 0 {
+			selected := true
+			for k, v := range rb.NamespaceSelector {
+				if lv, ok := l[k]; !ok || lv != v {
+					selected = false
+				}
+			}
+			if selected {
+				return namespace, true
+			}
+		}
+
+		if parent == nil {
+			break
+		}
+		next := parent(namespace)
+		if next == namespace {
+			break
+		}
+		namespace = next
+	}
+	return "", false
+}
+
+// referenceRuleMatches returns true if a rule matches a request
+func referenceRuleMatches(rule Rule, req Request) bool {
+	verbOk := false
+	for _, v := range rule.Verbs {
+		verbOk = verbOk || v == req.Verb
+	}
+	if !verbOk {
+		return false
+	}
+
+	if req.Path != "" {
+		for _, u := range rule.NonResourceURLs {
+			if referenceURLMatches(u, req.Path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	res := req.Resource
+	groupOk := len(rule.APIGroups) == 0 && res.APIGroup == ""
+	for _, g := range rule.APIGroups {
+		groupOk = groupOk || g == "*" || g == res.APIGroup
+	}
+
+	resourceOk := false
+	requested := res.Resource
+	if res.Subresource != "" {
+		requested += "/" + res.Subresource
+	}
+	for _, r := range rule.Resources {
+		resourceOk = resourceOk || referenceResourceMatches(r, requested)
+	}
+
+	nameOk := len(rule.ResourceNames) == 0
+	for _, n := range rule.ResourceNames {
+		nameOk = nameOk || n == res.ResourceName
+	}
+	return groupOk && resourceOk && nameOk
+}
+
+// referenceResourceMatches returns true if the resource pattern of a rule
+// matches a requested `resource` or `resource/subresource`
+func referenceResourceMatches(pattern, requested string) bool {
+	if pattern == "*" || pattern == requested {
+		return true
+	}
+
+	reqParts := strings.SplitN(requested, "/", 2)
+	patParts := strings.SplitN(pattern, "/", 2)
+	if len(reqParts) != 2 || len(patParts) != 2 {
+		return false
+	}
+	return patParts[1] == "*" && patParts[0] == reqParts[0] || patParts[0] == "*" && patParts[1] == reqParts[1]
+}
+
+// referenceURLMatches returns true if the URL pattern of a rule matches a path
+func referenceURLMatches(pattern, path string) bool {
+	if pattern == path {
+		return true
+	}
+	if pattern == "" || pattern[len(pattern)-1] != '*' {
+		return false
+	}
+	prefix := pattern[:len(pattern)-1]
+	return len(path) >= len(prefix) && path[:len(prefix)] == prefix
+}
+
+// policyGenerator derives a policy and requests from bytes, so fuzzing
+// explores the combinations of a small vocabulary
+type policyGenerator struct {
+	data []byte
+}
+
+// pick returns the next value below `n`, or zero when the data is exhausted
+func (g *policyGenerator) pick(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	v := int(g.data[0]) % n
+	g.data = g.data[1:]
+	return v
+}
+
+func (g *policyGenerator) choose(values []string) string {
+	return values[g.pick(len(values))]
+}
+
+// some returns up to `max` values, possibly none
+func (g *policyGenerator) some(values []string, max int) []string {
+	var ret []string
+	for i := g.pick(max + 1); i > 0; i-- {
+		ret = append(ret, g.choose(values))
+	}
+	return ret
+}
+
+var (
+	genVerbs      = []string{"get", "update", "delete", "*"}
+	genGroups     = []string{"", "apps", "*"}
+	genResources  = []string{"nodes", "pods", "nodes/states", "pods/logs", "nodes/*", "*/states", "*"}
+	genNames      = []string{"linux", "web"}
+	genPaths      = []string{"/healthz", "/debug/pprof", "/debug/*", "/*", "*"}
+	genNamespaces = []string{"", "linux", "team", "team/dev", "team/dev/x"}
+	genSubjects   = []Subject{{Name: "bofh", Kind: User}, {Name: "admins", Kind: Group}, {Name: "bofh", Kind: Group}, {Name: "ci", Kind: ServiceAccount}}
+	genConditions = []string{`attr.owner == subject.name`, `hour() >= 9 && hour() < 17`, `subject.kind == "Group" || extra.ip == "10.0.0.1"`}
+)
+
+// policy generates a valid policy with conditions of referenceConditions, a
+// namespace hierarchy or none and the start time of the evaluations
+func (g *policyGenerator) policy() (Policy, func(string) string, time.Time) {
+	now := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	var p Policy
+	roles := g.pick(3) + 1
+	for i := roles; i > 0; i-- {
+		r := Role{Name: "role-" + string(rune('a'+i))}
+		for j := g.pick(3) + 1; j > 0; j-- {
+			rule := Rule{Verbs: append([]string{g.choose(genVerbs)}, g.some(genVerbs, 1)...)}
+			if g.pick(4) == 0 {
+				rule.NonResourceURLs = append([]string{g.choose(genPaths)}, g.some(genPaths, 1)...)
+			} else {
+				rule.APIGroups = g.some(genGroups, 2)
+				rule.Resources = append([]string{g.choose(genResources)}, g.some(genResources, 1)...)
+				rule.ResourceNames = g.some(genNames, 1)
+			}
+			if g.pick(3) == 0 {
+				rule.Condition = g.choose(genConditions)
+			}
+			r.Rules = append(r.Rules, rule)
+		}
+		p.Roles = append(p.Roles, r)
+	}
+
+	for i := g.pick(4) + 1; i > 0; i-- {
+		rb := RoleBinding{
+			Name: "binding-" + string(rune('a'+i)),
+			Role: "role-" + string(rune('a'+g.pick(roles+1))),
+		}
+		for j := g.pick(2) + 1; j > 0; j-- {
+			rb.Subjects = append(rb.Subjects, genSubjects[g.pick(len(genSubjects))])
+		}
+
+		switch g.pick(4) {
+		case 1:
+			rb.Namespace = g.choose(genNamespaces[1:])
+		case 2:
+			rb.Namespaces = []string{g.choose(genNamespaces[1:]), g.choose(genNamespaces[1:])}
+		case 3:
+			rb.NamespaceSelector = map[string]string{"env": "prod"}
+		}
+
+		switch g.pick(6) {
+		case 1:
+			rb.NotBefore = now.Add(time.Hour)
+		case 2:
+			rb.NotAfter = now
+		case 3:
+			rb.NotBefore, rb.NotAfter = now.Add(-time.Hour), now.Add(time.Hour)
+		}
+		p.RoleBindings = append(p.RoleBindings, rb)
+	}
+
+	if g.pick(2) == 1 {
+		p.Namespaces = []Namespace{{Name: "team", Labels: map[string]string{"env": "prod"}}}
+	}
+
+	var parent func(string) string
+	if g.pick(2) == 1 {
+		parent = PathNamespaceParent("/")
+	}
+	return p, parent, now
+}
+
+// request generates a request. Half of the requests are derived from a
+// RoleBinding of the policy and a rule of its role, so they are likely granted.
+func (g *policyGenerator) request(p Policy) Request {
+	req := Request{Verb: g.choose(genVerbs)}
+	for i := g.pick(2) + 1; i > 0; i-- {
+		req.Subjects = append(req.Subjects, genSubjects[g.pick(len(genSubjects))])
+	}
+	req.Resource = Resource{
+		Namespace:    g.choose(genNamespaces),
+		APIGroup:     g.choose(genGroups),
+		Resource:     g.choose([]string{"nodes", "pods", "*"}),
+		Subresource:  g.choose([]string{"", "", "states", "logs", "*"}),
+		ResourceName: g.choose([]string{"", "linux", "web"}),
+	}
+	if owner := g.choose([]string{"", "bofh", "admins", "ci"}); owner != "" {
+		req.Resource.Attributes = map[string]string{"owner": owner}
+	}
+	if g.pick(3) == 0 {
+		req.Extra = map[string]string{"ip": g.choose([]string{"10.0.0.1", "10.0.0.2"})}
+	}
+	if g.pick(4) == 0 {
+		req.Path = g.choose(genPaths)
+		req.Resource = Resource{}
+	}
+	if g.pick(2) == 0 {
+		return req
+	}
+
+	rb := p.RoleBindings[g.pick(len(p.RoleBindings))]
+	req.Subjects = rb.Subjects
+	switch {
+	case rb.Namespace != "":
+		req.Resource.Namespace = rb.Namespace
+	case len(rb.Namespaces) > 0:
+		req.Resource.Namespace = rb.Namespaces[0]
+	case len(rb.NamespaceSelector) > 0:
+		req.Resource.Namespace = g.choose([]string{"team", "team/dev"})
+	}
+	for _, r := range p.Roles {
+		if r.Name != rb.Role || len(r.Rules) == 0 {
+			continue
+		}
+
+		rule := r.Rules[g.pick(len(r.Rules))]
+		req.Verb = g.choose(rule.Verbs)
+		if len(rule.NonResourceURLs) > 0 {
+			req.Path, req.Resource = g.choose(rule.NonResourceURLs), Resource{}
+			return req
+		}
+
+		req.Path = ""
+		req.Resource.Attributes = map[string]string{"owner": g.choose([]string{"bofh", "admins", "ci"})}
+		req.Resource.APIGroup = ""
+		if len(rule.APIGroups) > 0 {
+			req.Resource.APIGroup = g.choose(rule.APIGroups)
+		}
+		res := g.choose(rule.Resources)
+		req.Resource.Resource, req.Resource.Subresource = res, ""
+		if i := strings.IndexByte(res, '/'); i >= 0 {
+			req.Resource.Resource, req.Resource.Subresource = res[:i], res[i+1:]
+		}
+		if len(rule.ResourceNames) > 0 {
+			req.Resource.ResourceName = g.choose(rule.ResourceNames)
+		}
+	}
+	return req
+}
+
+// checkAgainstReference evaluates the requests with Eval, the decision cache,
+// EvalBatch, a Checker and Explain and compares the results with each other
+// and with the reference evaluator. The requests are evaluated twice while
+// the clock advances from `start` by 37 minutes per request, so cached
+// decisions must follow conditions on the time and the validity of
+// RoleBindings.
+func checkAgainstReference(t *testing.T, p Policy, parent func(string) string, start time.Time, requests []Request) {
+	t.Helper()
+
+	now := start
+
+	newAuthorizer := func() *Authorizer {
+		a := New()
+		a.SetClock(func() time.Time { return now })
+		if parent != nil {
+			a.SetNamespaceParent(parent)
+		}
+		if err := a.SetPolicy(p); err != nil {
+			t.Fatalf("SetPolicy failed with %q", err)
+		}
+		return a
+	}
+	a, cached := newAuthorizer(), newAuthorizer()
+	cached.SetCache(CacheConfig{Size: 16, NegativeSize: 16})
+
+	for i := 0; i < 2*len(requests); i++ {
+		req := requests[i%len(requests)]
+		now = start.Add(time.Duration(i) * 37 * time.Minute)
+
+		res, err := a.EvalContext(context.Background(), req)
+		if err != nil {
+			t.Fatalf("EvalContext failed with %q", err)
+		}
+
+		expected := referenceEval(p, parent, now, req)
+		got := referenceDecision{Success: res.Success, RoleBinding: res.RoleBinding, Rule: res.Rule,
+			Subject: Subject{Name: res.Subject, Kind: res.SubjectType}, Namespace: res.Namespace}
+		if got != expected {
+			t.Fatalf("Eval of %+v at %s returned %+v, reference returned %+v\npolicy: %+v", req, now, got, expected, p)
+		}
+
+		for j := 0; j < 2; j++ {
+			if c, _ := cached.EvalContext(context.Background(), req); !reflect.DeepEqual(c, res) {
+				t.Fatalf("Cached result %s at %s differs from %s", c, now, res)
+			}
+		}
+
+		if c := a.For(req.Subjects).CheckRequest(req); !reflect.DeepEqual(c, res) {
+			t.Fatalf("Checker result %s differs from %s", c, res)
+		}
+
+		if e := a.Explain(req); !reflect.DeepEqual(e.Result, res) {
+			t.Fatalf("Explain result %s differs from %s", e.Result, res)
+		}
+
+		// Batches don't carry request attributes
+		if req.Path == "" && req.Extra == nil {
+			b := a.EvalBatch(req.Subjects, []VerbResource{{Verb: req.Verb, Resource: req.Resource}})
+			if !reflect.DeepEqual(b[0], res) {
+				t.Fatalf("Batch result %s differs from %s", b[0], res)
+			}
+		}
+	}
+}
+
+// evalAgainstReference generates a policy and requests from `data` and checks
+// them against the reference evaluator
+func evalAgainstReference(t *testing.T, data []byte) {
+	g := &policyGenerator{data: data}
+	p, parent, now := g.policy()
+
+	var requests []Request
+	for i := 0; i < 16; i++ {
+		requests = append(requests, g.request(p))
+	}
+	checkAgainstReference(t, p, parent, now, requests)
+}
+
+// TestReferenceEvaluator tests the evaluators against the reference evaluator
+// on random policies. FuzzEval explores further policies.
+func TestReferenceEvaluator(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := make([]byte, 128)
+		rnd.Read(data)
+		evalAgainstReference(t, data)
+	}
+
+	// The reference agrees with the extensive Authorizer as well
+	a := createExtensiveAuthorizer()
+	var requests []Request
+	for _, s := range a.Policy().RoleBindings {
+		for _, verb := range []string{"get", "update", "patch"} {
+			for _, ns := range []string{"", "linux", "windows"} {
+				for _, res := range []string{"nodes", "locations", "states"} {
+					requests = append(requests, Request{Verb: verb, Subjects: s.Subjects,
+						Resource: Resource{Namespace: ns, Resource: res, ResourceName: "linux"}})
+					requests = append(requests, Request{Verb: verb, Subjects: s.Subjects,
+						Resource: Resource{Namespace: ns, Resource: "nodes", Subresource: res, ResourceName: "linux"}})
+				}
+			}
+		}
+	}
+	checkAgainstReference(t, a.Policy(), nil, time.Now(), requests)
+}
@@ -1,6 +1,10 @@
 package rbac
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // SubjectKind represents the kind of a subject
 type SubjectKind int
@@ -19,31 +23,112 @@ const (
 )
 
 func (t SubjectKind) String() string {
-	if t < User || t > ServiceAccount {
-		return ""
+	if !t.valid() {
+		return fmt.Sprintf("SubjectKind(%d)", int(t))
 	}
 
 	return []string{"User", "Group", "ServiceAccount"}[t-1]
 }
 
+// valid returns true if the SubjectKind is one of the defined kinds
+func (t SubjectKind) valid() bool {
+	return t >= User && t <= ServiceAccount
+}
+
+// UnknownSubjectKindError is returned when parsing an unknown SubjectKind
+type UnknownSubjectKindError struct {
+	Kind string
+}
+
+func (e *UnknownSubjectKindError) Error() string {
+	return fmt.Sprintf("unknown subject kind %q", e.Kind)
+}
+
+// ParseSubjectKind returns the SubjectKind for its name. The names are
+// case-insensitive and `sa` and `serviceaccount` are accepted as aliases. An
+// empty name returns the zero SubjectKind of denied Results.
+func ParseSubjectKind(s string) (SubjectKind, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return 0, nil
+	case "user":
+		return User, nil
+	case "group":
+		return Group, nil
+	case "serviceaccount", "sa":
+		return ServiceAccount, nil
+	}
+	return 0, &UnknownSubjectKindError{Kind: s}
+}
+
+// MarshalText encodes the SubjectKind as its name and the zero SubjectKind as
+// empty text, so denied Results can be encoded
+func (t SubjectKind) MarshalText() ([]byte, error) {
+	if t == 0 {
+		return []byte{}, nil
+	}
+	if !t.valid() {
+		return nil, fmt.Errorf("invalid subject kind %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a SubjectKind using ParseSubjectKind
+func (t *SubjectKind) UnmarshalText(text []byte) error {
+	kind, err := ParseSubjectKind(string(text))
+	if err != nil {
+		return err
+	}
+	*t = kind
+	return nil
+}
+
+// Set implements flag.Value, so a SubjectKind can be used as command line
+// flag. Unlike UnmarshalText, it requires a kind.
+func (t *SubjectKind) Set(s string) error {
+	if s == "" {
+		return &UnknownSubjectKindError{Kind: s}
+	}
+	return t.UnmarshalText([]byte(s))
+}
+
 // Rule represents a rule for authorization.
 // Verbs and resources are required. In order to evaluate successfully, the
 // request parameters must match a combination for all given fields.
+// Subresources are addressed as `resource/subresource`, where `nodes/*` matches
+// all subresources of nodes, `*/status` the status subresource of every resource
+// and `*` every resource including its subresources.
+// APIGroups restricts the rule to resources of the given API groups, where `""`
+// is the core group and `*` matches all groups. A rule without API groups only
+// applies to the core group.
+// NonResourceURLs grants access to paths that don't represent a resource, such
+// as `/healthz`. A trailing `*` matches all paths with the preceding prefix.
+// They are only evaluated by EvalNonResource and only for global RoleBindings.
+// If a condition is set, it must additionally evaluate to true for the request,
+// see the documentation of the condition language in conditions.go:
+//
+//	Verbs: ["update", "delete"]
+//	Resources: ["documents"]
+//	Condition: attr.owner == subject.name
 type Rule struct {
-	Verbs         []string
-	Resources     []string
-	ResourceNames []string
+	Verbs           []string `json:"verbs" yaml:"verbs,flow"`
+	APIGroups       []string `json:"apiGroups,omitempty" yaml:"apiGroups,flow,omitempty"`
+	Resources       []string `json:"resources,omitempty" yaml:"resources,flow,omitempty"`
+	ResourceNames   []string `json:"resourceNames,omitempty" yaml:"resourceNames,flow,omitempty"`
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty" yaml:"nonResourceURLs,flow,omitempty"`
+	Condition       string   `json:"condition,omitempty" yaml:"condition,omitempty"`
 }
 
 // Role represents a role for authorization.
 // A role is successfully evaluated if at least one (OR-logic) of the rules succeeds the evaluation.
-//     Name: node-watcher
-//     Rules:
-//     - Verbs: ["get", "list", "watch"]
-//       Resources: ["nodes", "locations"]
-//     - Verbs: ["get", "update", "delete"]
-//       Resources: ["nodes/states"]
-//       ResourceNames: ["linux"]
+//
+//	Name: node-watcher
+//	Rules:
+//	- Verbs: ["get", "list", "watch"]
+//	  Resources: ["nodes", "locations"]
+//	- Verbs: ["get", "update", "delete"]
+//	  Resources: ["nodes/states"]
+//	  ResourceNames: ["linux"]
 type Role struct {
 	Name  string
 	Rules []Rule
@@ -53,36 +138,79 @@ type Role struct {
 // If the namespace is set to an empty string, the evaluation succeedes for every request namespace,
 // thus representing a global scope. If it is set to a non empty value, the roles are only evaluated
 // for requests containing the same namespace.
-//     Name: administrators-are-node-watchers
-//     Role: node-watcher
-//     Namespace: nodes-of-bofh
-//     Subjects:
-//     - Name: bofh
-//       Kind: User
-//     - Name: administrators
-//       Kind: Group
-//     - Name: system:serviceaccount:nodes-of-bofh:bugging-software
-//       Kind: ServiceAccount
+//
+//	Name: administrators-are-node-watchers
+//	Role: node-watcher
+//	Namespace: nodes-of-bofh
+//	Subjects:
+//	- Name: bofh
+//	  Kind: User
+//	- Name: administrators
+//	  Kind: Group
+//	- Name: system:serviceaccount:nodes-of-bofh:bugging-software
+//	  Kind: ServiceAccount
+//
 // The example above shows a RoleBinding that applies the operations validated
 // by the role `node-watcher` at namespace `nodes-of-bofh` for bfh, administrators
-// and a software.
+// and a software. If a namespace hierarchy is configured with SetNamespaceParent,
+// the RoleBinding also applies to all descendants of its namespace.
+// A RoleBinding can apply to multiple namespaces by listing them in Namespaces
+// or by selecting them with NamespaceSelector, which matches the labels of the
+// namespaces registered with SetNamespace. In this case the RoleBinding applies
+// to the union of Namespace, Namespaces and the selected namespaces.
+// NotBefore and NotAfter optionally restrict the time in which the RoleBinding
+// is valid, a zero value means no restriction. Approvals records the approval
+// chain of RoleBindings created by an AccessManager.
+//
+//	Name: team-a-developers
+//	Role: developer
+//	Namespaces: ["team-a-dev", "team-a-staging"]
+//	NamespaceSelector:
+//	  team: a
+//	Subjects:
+//	- Name: team-a
+//	  Kind: Group
 type RoleBinding struct {
-	Name      string
-	Role      string
-	Namespace string
-	Subjects  []Subject
+	Name              string
+	Role              string
+	Namespace         string
+	Namespaces        []string
+	NamespaceSelector map[string]string
+	Subjects          []Subject
+	NotBefore         time.Time
+	NotAfter          time.Time
+	Approvals         []Approval
+}
+
+// timeBounded returns true if the RoleBinding has a validity period
+func (r RoleBinding) timeBounded() bool {
+	return !r.NotBefore.IsZero() || !r.NotAfter.IsZero()
+}
+
+// validAt returns true if the RoleBinding is valid at time `t`
+func (r RoleBinding) validAt(t time.Time) bool {
+	return (r.NotBefore.IsZero() || !t.Before(r.NotBefore)) && (r.NotAfter.IsZero() || t.Before(r.NotAfter))
+}
+
+// Namespace represents the metadata of a namespace. Its labels can be selected
+// by RoleBindings.
+type Namespace struct {
+	Name   string
+	Labels map[string]string
 }
 
 // Subject represents a requestor that requests a resource. The following block
 // shows an example of subjects inspired by Kubernetes RBAC authorization:
-//     - Name: bofh
-//       Kind: User
-//     - Name: administrators
-//       Kind: Group
-//     - Name: system:serviceaccount:my-namespace:my-account
-//       Kind: ServiceAccount
-//     - Name: system:authenticated
-//       Kind: Group
+//
+//	Subjects:
+//	- Name: bofh
+//	  Kind: User
+//	- Name: administrators
+//	  Kind: Group
+//	- Name: system:serviceaccount:my-namespace:my-account
+//	  Kind: ServiceAccount
+//	- Name: system:authenticated
+//	  Kind: Group
 type Subject struct {
 	Name string
 	Kind SubjectKind
@@ -93,29 +221,99 @@ func (s Subject) String() string {
 }
 
 // Resource represents a requested resource. An empty namespace value represents
-// the global scope.
+// the global scope. An empty API group represents the core group, other groups
+// allow resources with the same name to be distinguished. The subresource is
+// optional and addresses a part of the resource such as `status` or `logs`.
+// Attributes are optional and can be used by rule conditions.
 type Resource struct {
-	Namespace    string
-	Resource     string
-	ResourceName string
+	Namespace    string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	APIGroup     string            `json:"apiGroup,omitempty" yaml:"apiGroup,omitempty"`
+	Resource     string            `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Subresource  string            `json:"subresource,omitempty" yaml:"subresource,omitempty"`
+	ResourceName string            `json:"resourceName,omitempty" yaml:"resourceName,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
 }
 
 func (r Resource) String() string {
-	return fmt.Sprintf("%q:%q:%q", r.Namespace, r.Resource, r.ResourceName)
+	res := r.Resource
+	if r.APIGroup != "" {
+		res += "." + r.APIGroup
+	}
+	if r.Subresource != "" {
+		res += "/" + r.Subresource
+	}
+	return fmt.Sprintf("%q:%q:%q", r.Namespace, res, r.ResourceName)
+}
+
+// path returns the resource in the form `resource` or `resource/subresource`
+func (r Resource) path() string {
+	if r.Subresource == "" {
+		return r.Resource
+	}
+	return r.Resource + "/" + r.Subresource
+}
+
+// Request represents an authorization request of subjects that want to apply a
+// verb to a resource. If Path is set, the request is for a non-resource URL and
+// Resource is ignored. Extra optionally carries attributes of the request
+// itself, such as the client IP, that can be used by rule conditions.
+// Requests can be encoded as JSON and YAML in order to record and replay them:
+//
+//	verb: get
+//	subjects:
+//	- kind: User
+//	  name: bofh
+//	resource:
+//	  namespace: linux
+//	  resource: nodes
+//	extra:
+//	  ip: 10.0.0.1
+type Request struct {
+	Verb     string            `json:"verb" yaml:"verb"`
+	Subjects []Subject         `json:"subjects" yaml:"subjects"`
+	Resource Resource          `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Path     string            `json:"path,omitempty" yaml:"path,omitempty"`
+	Extra    map[string]string `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// result returns a failed Result for the request
+func (r Request) result() Result {
+	return Result{
+		Request:           r,
+		RequestingSubject: r.Subjects,
+		RequestedVerb:     r.Verb,
+		RequestedResource: r.Resource,
+	}
 }
 
 // Result represents a RBAC evaluation result. If the evaluation was successful,
-// the field `Success` will be true and the other fields will be set to the parameters
-// that were accepted
+// the field `Success` will be true and the other fields will be set to the
+// parameters that were accepted. Rule is the index of the granting rule in the
+// Role and Namespace is the namespace of the RoleBinding that granted the
+// request, which is an ancestor of the requested namespace if the binding was
+// inherited. Expires is the expiry of the RoleBinding, a decision must not be
+// reused after this time unless it is zero. ConditionFailures lists the rules
+// that matched the request but were rejected because of their condition.
 type Result struct {
-	Success     bool
-	RoleBinding string
-	Role        string
-	Subject     string
-	SubjectType SubjectKind
+	Success           bool
+	RoleBinding       string
+	Role              string
+	Rule              int
+	Subject           string
+	SubjectType       SubjectKind
+	Namespace         string
+	Expires           time.Time
+	ConditionFailures []string
+
+	// Request is the evaluated request
+	Request Request
 
-	// Request parameters
+	// Deprecated: use Request.Subjects instead
 	RequestingSubject []Subject
-	RequestedVerb     string
+
+	// Deprecated: use Request.Verb instead
+	RequestedVerb string
+
+	// Deprecated: use Request.Resource instead
 	RequestedResource Resource
 }
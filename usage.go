@@ -0,0 +1,188 @@
+package rbac
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UsageKey identifies a rule of a RoleBinding that granted a request to one of
+// the subjects of the RoleBinding
+type UsageKey struct {
+	RoleBinding string
+	Rule        int
+	Subject     Subject
+}
+
+// Usage represents the requests granted within a time window, counted by the
+// RoleBinding, rule and subject that granted them. It can be taken from the
+// live counters of a MetricsRecorder or from an audit log.
+type Usage struct {
+	From time.Time
+	To   time.Time
+	Hits map[UsageKey]uint64
+}
+
+// UsageFromAuditLog counts the allowed decisions of the records within the
+// window from `from` until before `to`. A zero time leaves the respective end
+// of the window open.
+func UsageFromAuditLog(records []AuditRecord, from, to time.Time) Usage {
+	u := Usage{From: from, To: to, Hits: map[UsageKey]uint64{}}
+	for _, rec := range records {
+		if !rec.Allowed || !from.IsZero() && rec.Time.Before(from) || !to.IsZero() && !rec.Time.Before(to) {
+			continue
+		}
+
+		key := UsageKey{RoleBinding: rec.RoleBinding, Rule: rec.Rule}
+		if rec.Subject != nil {
+			key.Subject = *rec.Subject
+		}
+		u.Hits[key]++
+	}
+	return u
+}
+
+// UnusedRule represents rule `Rule` of a Role that didn't grant any request
+type UnusedRule struct {
+	Role string
+	Rule int
+}
+
+// SubjectUsage represents how many of the rules granted to a subject by its
+// RoleBindings were used
+type SubjectUsage struct {
+	Subject Subject
+	Granted int
+	Used    int
+}
+
+// UnusedReport lists the RoleBindings and rules that didn't grant any request
+// within the time window of a Usage and the subjects that used only a small
+// part of their permissions
+type UnusedReport struct {
+	From         time.Time
+	To           time.Time
+	RoleBindings []string
+	Rules        []UnusedRule
+	Subjects     []SubjectUsage
+}
+
+// UnusedPermissions compares the usage with the current policy. Subjects are
+// reported if they used at most `maxUsedRatio` of the rules granted to them,
+// so 0.5 lists subjects that didn't use at least half of their rules. Usage of
+// RoleBindings that don't exist anymore is ignored and audit records without
+// subject only count for the RoleBindings and rules.
+func (a *Authorizer) UnusedPermissions(u Usage, maxUsedRatio float64) UnusedReport {
+	usedBindings := map[string]bool{}
+	usedRules := map[UsageKey]bool{}
+	for key, hits := range u.Hits {
+		if hits == 0 {
+			continue
+		}
+		usedBindings[key.RoleBinding] = true
+		usedRules[UsageKey{RoleBinding: key.RoleBinding, Rule: key.Rule}] = true
+		usedRules[key] = true
+	}
+
+	report := UnusedReport{From: u.From, To: u.To}
+	roleUsed := map[string][]bool{}
+	subjects := map[Subject]*SubjectUsage{}
+
+	a.RLock()
+	for _, name := range a.bindingOrder {
+		rb := a.rolebindings[name]
+		if !usedBindings[name] {
+			report.RoleBindings = append(report.RoleBindings, name)
+		}
+
+		role, ok := a.roles[rb.Role]
+		if !ok {
+			continue
+		}
+
+		if roleUsed[role.Name] == nil {
+			roleUsed[role.Name] = make([]bool, len(role.Rules))
+		}
+		for i := range role.Rules {
+			if usedRules[UsageKey{RoleBinding: name, Rule: i}] {
+				roleUsed[role.Name][i] = true
+			}
+		}
+
+		for _, s := range rb.Subjects {
+			su, ok := subjects[s]
+			if !ok {
+				su = &SubjectUsage{Subject: s}
+				subjects[s] = su
+			}
+			for i := range role.Rules {
+				su.Granted++
+				if usedRules[UsageKey{RoleBinding: name, Rule: i, Subject: s}] {
+					su.Used++
+				}
+			}
+		}
+	}
+
+	for name, role := range a.roles {
+		for i := range role.Rules {
+			if used := roleUsed[name]; used == nil || !used[i] {
+				report.Rules = append(report.Rules, UnusedRule{Role: name, Rule: i})
+			}
+		}
+	}
+	a.RUnlock()
+
+	sort.Slice(report.Rules, func(i, j int) bool {
+		if report.Rules[i].Role != report.Rules[j].Role {
+			return report.Rules[i].Role < report.Rules[j].Role
+		}
+		return report.Rules[i].Rule < report.Rules[j].Rule
+	})
+
+	for _, su := range subjects {
+		if su.Granted > 0 && float64(su.Used) <= maxUsedRatio*float64(su.Granted) {
+			report.Subjects = append(report.Subjects, *su)
+		}
+	}
+	sort.Slice(report.Subjects, func(i, j int) bool {
+		si, sj := report.Subjects[i], report.Subjects[j]
+		// Order by the used fraction, compared without division
+		if si.Used*sj.Granted != sj.Used*si.Granted {
+			return si.Used*sj.Granted < sj.Used*si.Granted
+		}
+		return si.Subject.String() < sj.Subject.String()
+	})
+
+	return report
+}
+
+func (r UnusedReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage from %s to %s\n", reportTime(r.From), reportTime(r.To))
+
+	b.WriteString("Unused RoleBindings:\n")
+	for _, name := range r.RoleBindings {
+		fmt.Fprintf(&b, "  %s\n", name)
+	}
+
+	b.WriteString("Unused rules:\n")
+	for _, rule := range r.Rules {
+		fmt.Fprintf(&b, "  rule %d of role %s\n", rule.Rule, rule.Role)
+	}
+
+	b.WriteString("Subjects with unused permissions:\n")
+	for _, su := range r.Subjects {
+		fmt.Fprintf(&b, "  %s used %d of %d rules\n", su.Subject, su.Used, su.Granted)
+	}
+	return b.String()
+}
+
+// reportTime formats a time of a report, where a zero time is open
+func reportTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,62 @@
+package rbac
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestUnusedPermissions tests the unused permission report from live counters
+// and from an audit log
+func TestUnusedPermissions(t *testing.T) {
+	a := createExtensiveAuthorizer()
+	m := NewMetricsRecorder()
+	a.SetMetrics(m)
+	buf := &bytes.Buffer{}
+	a.SetAuditSink(NewAuditLog(buf))
+
+	bofh := []Subject{{Name: "bofh", Kind: User}}
+	auditor := []Subject{{Name: "auditor", Kind: ServiceAccount}}
+	a.Eval("get", bofh, Resource{Namespace: "linux", Resource: "nodes"})
+	a.Eval("list", bofh, Resource{Namespace: "linux", Resource: "locations"})
+	a.Eval("get", auditor, Resource{Resource: "nodes"})
+	a.Eval("delete", auditor, Resource{Resource: "nodes"})
+
+	expected := UnusedReport{
+		RoleBindings: []string{"global-node-watchers"},
+		Rules:        []UnusedRule{{Role: "node-watcher", Rule: 1}},
+		Subjects: []SubjectUsage{
+			{Subject: Subject{Name: "superusers", Kind: Group}, Granted: 2},
+			{Subject: Subject{Name: "system:core", Kind: Group}, Granted: 2},
+			{Subject: Subject{Name: "integrator", Kind: ServiceAccount}, Granted: 2},
+			{Subject: Subject{Name: "bofh", Kind: User}, Granted: 2, Used: 1},
+		},
+	}
+
+	report := a.UnusedPermissions(m.Usage(), 0.5)
+	report.From, report.To = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Unexpected report from counters:\n%s", report)
+	}
+
+	records, err := ReadAuditLog(buf)
+	if err != nil {
+		t.Fatalf("ReadAuditLog failed with %q", err)
+	}
+	report = a.UnusedPermissions(UsageFromAuditLog(records, time.Time{}, time.Time{}), 0.5)
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Unexpected report from audit log:\n%s", report)
+	}
+	if !strings.Contains(report.String(), "User:bofh used 1 of 2 rules") {
+		t.Errorf("Report should list bofh:\n%s", report)
+	}
+
+	// Decisions outside of the window are ignored
+	from := records[len(records)-1].Time.Add(time.Second)
+	report = a.UnusedPermissions(UsageFromAuditLog(records, from, time.Time{}), 0)
+	if len(report.RoleBindings) != 3 || len(report.Rules) != 3 || len(report.Subjects) != 5 {
+		t.Errorf("Everything should be unused after the window:\n%s", report)
+	}
+}